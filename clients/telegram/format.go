@@ -0,0 +1,53 @@
+package telegram
+
+import "strings"
+
+// ParseMode tells Telegram how to format a message text or caption
+type ParseMode string
+
+const (
+	ModePlain      ParseMode = ""
+	ModeHTML       ParseMode = "HTML"
+	ModeMarkdownV2 ParseMode = "MarkdownV2"
+)
+
+var (
+	htmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+	// every character MarkdownV2 reserves outside of code
+	markdownEscaper = strings.NewReplacer(
+		`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`,
+		"~", `\~`, "`", "\\`", ">", `\>`, "#", `\#`, "+", `\+`, "-", `\-`, "=", `\=`,
+		"|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`, "!", `\!`,
+	)
+
+	// inside `code` and ```pre``` only these two are special
+	markdownCodeEscaper = strings.NewReplacer(`\`, `\\`, "`", "\\`")
+)
+
+// EscapeHTML makes s safe to put into a ModeHTML text
+func EscapeHTML(s string) string {
+	return htmlEscaper.Replace(s)
+}
+
+// EscapeMarkdownV2 makes s safe to put into a ModeMarkdownV2 text
+func EscapeMarkdownV2(s string) string {
+	return markdownEscaper.Replace(s)
+}
+
+// EscapeMarkdownV2Code makes s safe to put between backticks of a ModeMarkdownV2 text
+func EscapeMarkdownV2Code(s string) string {
+	return markdownCodeEscaper.Replace(s)
+}
+
+// Escape makes s safe to put into a text sent with mode
+func Escape(s string, mode ParseMode) string {
+	switch mode {
+	case ModeHTML:
+		return EscapeHTML(s)
+	case ModeMarkdownV2:
+		return EscapeMarkdownV2(s)
+	default:
+		return s
+	}
+}
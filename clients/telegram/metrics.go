@@ -0,0 +1,36 @@
+package telegram
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"flashcard/lib/metrics"
+)
+
+// apiBuckets also cover getUpdates, which waits up to the poll timeout
+var apiBuckets = append(append([]float64(nil), metrics.DefBuckets...), 30, 60)
+
+var (
+	apiCalls = metrics.Default.Counter(
+		"flashcard_telegram_api_calls_total",
+		"Telegram Bot API calls by method and HTTP status, \"error\" if no response came.",
+		"method", "status",
+	)
+	apiLatency = metrics.Default.Histogram(
+		"flashcard_telegram_api_duration_seconds",
+		"Time Telegram Bot API calls took, by method.",
+		apiBuckets,
+		"method",
+	)
+)
+
+// observe records a finished API call
+func observe(method string, start time.Time, resp *http.Response, err error) {
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+	apiCalls.Inc(method, status)
+	apiLatency.Observe(time.Since(start).Seconds(), method)
+}
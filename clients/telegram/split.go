@@ -0,0 +1,188 @@
+package telegram
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// maxMessageLength is the longest text Telegram accepts in one message
+const maxMessageLength = 4096
+
+// splitMessage cuts text into parts of at most limit characters, at line
+// boundaries where possible. Only a single line longer than limit is cut
+// in the middle. A ModeHTML text is never cut inside a tag or an entity
+// such as &amp;, and tags open at a cut are closed at the end of the part
+// and opened again at the start of the next one.
+func splitMessage(text string, limit int, mode ParseMode) []string {
+	if utf8.RuneCountInString(text) <= limit {
+		return []string{text}
+	}
+
+	var (
+		parts  []string
+		cur    strings.Builder
+		reopen string    // the tags cur continues from the last part
+		n      int       // runes in reopen and cur
+		open   []htmlTag // tags open at the end of cur
+	)
+	flush := func() {
+		if part := strings.Trim(cur.String(), "\n"); part != "" {
+			parts = append(parts, reopen+part+closingTags(open))
+		}
+		cur.Reset()
+		reopen = openingTags(open)
+		n = utf8.RuneCountInString(reopen)
+	}
+	add := func(s string, size int, tags []htmlTag) {
+		cur.WriteString(s)
+		n += size
+		open = tags
+	}
+
+	for _, line := range strings.SplitAfter(text, "\n") {
+		pieces := splitPieces(line, mode)
+		after := open
+		for _, pc := range pieces {
+			after = pc.apply(after)
+		}
+		size := utf8.RuneCountInString(line)
+		if n+size+closingLen(after) > limit {
+			flush()
+		}
+		if n+size+closingLen(after) <= limit {
+			add(line, size, after)
+			continue
+		}
+
+		// the line doesn't fit even in a part of its own
+		for _, pc := range pieces {
+			size := utf8.RuneCountInString(pc.text)
+			tags := pc.apply(open)
+			if n+size+closingLen(tags) > limit && cur.Len() > 0 {
+				flush()
+			}
+			add(pc.text, size, tags)
+		}
+	}
+	flush()
+
+	return parts
+}
+
+// truncateMessage cuts text to at most limit characters, the way
+// splitMessage cuts its first part
+func truncateMessage(text string, limit int, mode ParseMode) string {
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	return splitMessage(text, limit, mode)[0]
+}
+
+// piece is a bit of text a cut must not go through: a rune, or in
+// ModeHTML a whole tag or entity
+type piece struct {
+	text string
+	tag  *htmlTag // set for a tag
+	end  bool     // the tag is a closing one
+}
+
+// htmlTag is a tag of a ModeHTML text as it was opened
+type htmlTag struct {
+	name string // as in the closing tag
+	open string // the opening tag with its attributes
+}
+
+// apply returns the tags open after pc, given those open before it
+func (pc piece) apply(open []htmlTag) []htmlTag {
+	switch {
+	case pc.tag == nil:
+		return open
+	case !pc.end:
+		return append(open[:len(open):len(open)], *pc.tag)
+	}
+	for i := len(open) - 1; i >= 0; i-- {
+		if open[i].name == pc.tag.name {
+			return append(open[:i:i], open[i+1:]...)
+		}
+	}
+	return open
+}
+
+// splitPieces splits s into the pieces a cut may go between
+func splitPieces(s string, mode ParseMode) []piece {
+	var pieces []piece
+	for s != "" {
+		n := 0
+		if mode == ModeHTML {
+			n = markupLen(s)
+		}
+		if n == 0 {
+			_, n = utf8.DecodeRuneInString(s)
+		}
+
+		pc := piece{text: s[:n]}
+		if n > 1 && s[0] == '<' {
+			name := strings.TrimPrefix(pc.text[1:n-1], "/")
+			if i := strings.IndexAny(name, " \t\n"); i >= 0 {
+				name = name[:i]
+			}
+			pc.tag = &htmlTag{name: strings.ToLower(name), open: pc.text}
+			pc.end = pc.text[1] == '/'
+		}
+		pieces = append(pieces, pc)
+		s = s[n:]
+	}
+	return pieces
+}
+
+// markupLen returns the length of the tag or entity s starts with, 0 if none
+func markupLen(s string) int {
+	switch s[0] {
+	case '<':
+		if i := strings.IndexByte(s, '>'); i > 1 {
+			return i + 1
+		}
+	case '&':
+		i := 1
+		if i < len(s) && s[i] == '#' {
+			i++
+		}
+		for i < len(s) && i <= 10 && isAlnum(s[i]) {
+			i++
+		}
+		if i < len(s) && s[i] == ';' && i > 1 {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func isAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// openingTags opens the tags again, outermost first
+func openingTags(open []htmlTag) string {
+	var b strings.Builder
+	for _, t := range open {
+		b.WriteString(t.open)
+	}
+	return b.String()
+}
+
+// closingTags closes the open tags, innermost first
+func closingTags(open []htmlTag) string {
+	var b strings.Builder
+	for i := len(open) - 1; i >= 0; i-- {
+		b.WriteString("</" + open[i].name + ">")
+	}
+	return b.String()
+}
+
+func closingLen(open []htmlTag) int {
+	n := 0
+	for _, t := range open {
+		n += len("</>") + utf8.RuneCountInString(t.name)
+	}
+	return n
+}
@@ -0,0 +1,99 @@
+package telegram
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitMessage(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		mode  ParseMode
+		want  []string
+	}{
+		{name: "short", text: "hello", limit: 5, want: []string{"hello"}},
+		{name: "counts runes, not bytes", text: "привет", limit: 6, want: []string{"привет"}},
+		{name: "at line breaks", text: "ab\ncd\nef", limit: 5, want: []string{"ab", "cd\nef"}},
+		{name: "blank lines at a cut", text: "ab\n\n\ncd", limit: 3, want: []string{"ab", "cd"}},
+		{name: "long line", text: "héllo wörld", limit: 4, want: []string{"héll", "o wö", "rld"}},
+		{name: "long line then more", text: "12345678\nab", limit: 4, want: []string{"1234", "5678", "ab"}},
+		{name: "emoji", text: "😀😀😀", limit: 2, want: []string{"😀😀", "😀"}},
+		{name: "long line among short ones", text: "a\nbbbbbb\nc", limit: 3, want: []string{"a", "bbb", "bbb", "c"}},
+		{name: "html entity", text: "ab&amp;cd", limit: 6, mode: ModeHTML, want: []string{"ab", "&amp;c", "d"}},
+		{name: "html tags reopened", text: "<b>abcdef</b>", limit: 9, mode: ModeHTML, want: []string{"<b>ab</b>", "<b>cd</b>", "<b>ef</b>"}},
+		{name: "plain text has no tags", text: "<b>abc</b>", limit: 5, want: []string{"<b>ab", "c</b>"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitMessage(tt.text, tt.limit, tt.mode)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			for _, part := range got {
+				if n := utf8.RuneCountInString(part); n > tt.limit {
+					t.Errorf("part %q has %d runes, more than %d", part, n, tt.limit)
+				}
+				if !utf8.ValidString(part) {
+					t.Errorf("part %q cuts a rune", part)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitMessageKeepsText(t *testing.T) {
+	text := strings.Repeat("Съешь же ещё этих мягких французских булок.\n", 200)
+
+	parts := splitMessage(text, maxMessageLength, ModePlain)
+	if len(parts) < 2 {
+		t.Fatalf("got %d parts", len(parts))
+	}
+	if got := strings.Join(parts, "\n"); got != strings.TrimRight(text, "\n") {
+		t.Error("joined parts differ from the text")
+	}
+}
+
+func TestSplitMessageHTML(t *testing.T) {
+	line := "<b>" + strings.Repeat(EscapeHTML("Tom & Jerry <3 "), 400) + "</b> <code>" + strings.Repeat("x", 5000) + "</code>"
+	text := line + "\n" + line
+
+	parts := splitMessage(text, maxMessageLength, ModeHTML)
+	if len(parts) < 4 {
+		t.Fatalf("got %d parts", len(parts))
+	}
+
+	var plain strings.Builder
+	for _, part := range parts {
+		if n := utf8.RuneCountInString(part); n > maxMessageLength {
+			t.Errorf("part has %d runes, more than %d", n, maxMessageLength)
+		}
+		for _, tag := range []string{"b", "code"} {
+			if strings.Count(part, "<"+tag+">") != strings.Count(part, "</"+tag+">") {
+				t.Errorf("part leaves <%s> open: %q…", tag, part[:40])
+			}
+		}
+		if got := strings.Count(part, "&"); got != strings.Count(part, "&amp;")+strings.Count(part, "&lt;") {
+			t.Errorf("part cuts an entity: %q…", part[:40])
+		}
+		plain.WriteString(stripTags(part))
+	}
+	if want := strings.ReplaceAll(stripTags(text), "\n", ""); plain.String() != want {
+		t.Error("the parts' text differs from the text")
+	}
+}
+
+// stripTags drops the tags of a ModeHTML text
+func stripTags(s string) string {
+	var b strings.Builder
+	for _, pc := range splitPieces(s, ModeHTML) {
+		if pc.tag == nil {
+			b.WriteString(pc.text)
+		}
+	}
+	return b.String()
+}
@@ -1,31 +1,84 @@
 package telegram
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"flashcard/lib/e"
+	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"net/url"
 	"path"
 	"strconv"
+	"time"
 )
 
+// ErrNotOK is returned when the Bot API answers with "ok": false
+var ErrNotOK = errors.New("telegram api returned not ok")
+
+// APIError is a Bot API answer with "ok": false. It matches ErrNotOK.
+type APIError struct {
+	Code        int
+	Description string
+}
+
+func (a *APIError) Error() string {
+	return fmt.Sprintf("%s: %d %s", ErrNotOK, a.Code, a.Description)
+}
+
+func (a *APIError) Is(target error) bool {
+	return target == ErrNotOK
+}
+
+// Permanent reports whether sending the same request again can't help,
+// e.g. the chat is gone or the bot was blocked. Too Many Requests is
+// worth retrying later.
+func (a *APIError) Permanent() bool {
+	return a.Code >= 400 && a.Code < 500 && a.Code != http.StatusTooManyRequests
+}
+
+// ErrFileTooBig is returned when a file exceeds the size the caller accepts
+var ErrFileTooBig = errors.New("file is too big")
+
 type Client struct {
-	host     string
-	basePath string
-	client   http.Client
+	host        string
+	basePath    string
+	pollTimeout time.Duration
+	client      http.Client
 }
 
+// requestSlack is how much longer than a long poll a request may take
+// before the HTTP client gives up on it
+const requestSlack = 10 * time.Second
+
+// allowedUpdates are the update types the bot handles; Telegram drops the rest
+const allowedUpdates = `["message","callback_query"]`
+
 const (
-	getUpdatesMethod  = "getUpdates"
-	sendMessageMethod = "sendMessage"
+	getUpdatesMethod    = "getUpdates"
+	sendMessageMethod   = "sendMessage"
+	getMeMethod         = "getMe"
+	getChatMemberMethod = "getChatMember"
+	getFileMethod       = "getFile"
+	sendPhotoMethod     = "sendPhoto"
+	sendVoiceMethod     = "sendVoice"
+	sendAudioMethod     = "sendAudio"
+
+	editMessageTextMethod     = "editMessageText"
+	answerCallbackQueryMethod = "answerCallbackQuery"
+	setMyCommandsMethod       = "setMyCommands"
 )
 
-func New(host string, token string) *Client {
+// New creates a client. getUpdates waits up to pollTimeout for new updates,
+// so every request is allowed a bit more than that.
+func New(host string, token string, pollTimeout time.Duration) *Client {
 	return &Client{
-		host:     host,
-		basePath: newBasePath(token),
-		client:   http.Client{},
+		host:        host,
+		basePath:    newBasePath(token),
+		pollTimeout: pollTimeout,
+		client:      http.Client{Timeout: pollTimeout + requestSlack},
 	}
 }
 
@@ -39,11 +92,17 @@ func (c *Client) Updates(offset, limit int) (updates []Update, err error) {
 
 	q.Add("offset", strconv.Itoa(offset))
 	q.Add("limit", strconv.Itoa(limit))
+	q.Add("timeout", strconv.Itoa(int(c.pollTimeout/time.Second)))
+	q.Add("allowed_updates", allowedUpdates)
 
 	data, err := c.doRequest(getUpdatesMethod, q)
 	if err != nil {
 		return nil, err
 	}
+	// e.g. a revoked token or another instance polling with the same one
+	if err := checkOK(data); err != nil {
+		return nil, err
+	}
 	var res UpdatesResponse
 
 	if err := json.Unmarshal(data, &res); err != nil {
@@ -51,19 +110,353 @@ func (c *Client) Updates(offset, limit int) (updates []Update, err error) {
 	}
 	return res.Result, nil
 }
+
+// Me returns the bot's own account
+func (c *Client) Me() (me User, err error) {
+	defer func() { err = e.WrapIfErr("can't get me", err) }()
+
+	data, err := c.doRequest(getMeMethod, url.Values{})
+	if err != nil {
+		return User{}, err
+	}
+	var res MeResponse
+
+	if err := json.Unmarshal(data, &res); err != nil {
+		return User{}, err
+	}
+	if !res.OK {
+		return User{}, ErrNotOK
+	}
+	return res.Result, nil
+}
+
+// ChatMember returns the membership of a user in a chat
+func (c *Client) ChatMember(chatID, userID int) (member ChatMember, err error) {
+	defer func() { err = e.WrapIfErr("can't get chat member", err) }()
+	q := url.Values{}
+
+	q.Add("chat_id", strconv.Itoa(chatID))
+	q.Add("user_id", strconv.Itoa(userID))
+
+	data, err := c.doRequest(getChatMemberMethod, q)
+	if err != nil {
+		return ChatMember{}, err
+	}
+	var res ChatMemberResponse
+
+	if err := json.Unmarshal(data, &res); err != nil {
+		return ChatMember{}, err
+	}
+	if !res.OK {
+		return ChatMember{}, ErrNotOK
+	}
+	return res.Result, nil
+}
+
+// DownloadFile fetches an uploaded file, refusing files larger than maxSize bytes
+func (c *Client) DownloadFile(fileID string, maxSize int) (data []byte, err error) {
+	defer func() { err = e.WrapIfErr("can't download file", err) }()
+	q := url.Values{}
+
+	q.Add("file_id", fileID)
+
+	data, err = c.doRequest(getFileMethod, q)
+	if err != nil {
+		return nil, err
+	}
+	var res FileResponse
+
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	if !res.OK {
+		return nil, ErrNotOK
+	}
+	if res.Result.FileSize > maxSize {
+		return nil, ErrFileTooBig
+	}
+
+	u := url.URL{
+		Scheme: "https",
+		Host:   c.host,
+		Path:   path.Join("file", c.basePath, res.Result.FilePath),
+	}
+
+	start := time.Now()
+	resp, err := c.client.Get(u.String())
+	observe("file", start, resp, err)
+	if err != nil {
+		return nil, withoutURL(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	data, err = io.ReadAll(io.LimitReader(resp.Body, int64(maxSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxSize {
+		return nil, ErrFileTooBig
+	}
+	return data, nil
+}
+
 func (c *Client) SendMessage(chatId int, text string) error {
+	return c.SendFormatted(chatId, text, ModePlain)
+}
+
+// SendFormatted sends text marked up for mode; user input in it must be escaped.
+// Text over Telegram's length limit goes out as several messages.
+func (c *Client) SendFormatted(chatID int, text string, mode ParseMode) error {
+	return c.SendKeyboard(chatID, text, mode, nil)
+}
+
+// SendKeyboard sends text with inline buttons under it. If the text has to be
+// split, the buttons go under the last part.
+func (c *Client) SendKeyboard(chatID int, text string, mode ParseMode, kb *InlineKeyboardMarkup) error {
+	parts := splitMessage(text, maxMessageLength, mode)
+	for i, part := range parts {
+		q := url.Values{}
+
+		q.Add("chat_id", strconv.Itoa(chatID))
+		q.Add("text", part)
+		addParseMode(q, mode)
+		if i == len(parts)-1 {
+			if err := addKeyboard(q, kb); err != nil {
+				return e.Wrap("can't send message", err)
+			}
+		}
+
+		data, err := c.doRequest(sendMessageMethod, q)
+		if err != nil {
+			return e.Wrap("can't send message", err)
+		}
+		if err := checkOK(data); err != nil {
+			return e.Wrap("can't send message", err)
+		}
+	}
+	return nil
+}
+
+// EditMessage replaces the text and buttons of a message the bot sent
+func (c *Client) EditMessage(chatID, messageID int, text string, mode ParseMode, kb *InlineKeyboardMarkup) (err error) {
+	defer func() { err = e.WrapIfErr("can't edit message", err) }()
+
+	q := url.Values{}
+
+	q.Add("chat_id", strconv.Itoa(chatID))
+	q.Add("message_id", strconv.Itoa(messageID))
+	q.Add("text", truncateMessage(text, maxMessageLength, mode))
+	addParseMode(q, mode)
+	if err := addKeyboard(q, kb); err != nil {
+		return err
+	}
+
+	data, err := c.doRequest(editMessageTextMethod, q)
+	if err != nil {
+		return err
+	}
+	return checkOK(data)
+}
+
+// AnswerCallback stops the button's loading animation, showing text if given
+func (c *Client) AnswerCallback(callbackID, text string) (err error) {
+	defer func() { err = e.WrapIfErr("can't answer callback", err) }()
+
+	q := url.Values{}
+
+	q.Add("callback_query_id", callbackID)
+	if text != "" {
+		q.Add("text", text)
+	}
+
+	data, err := c.doRequest(answerCallbackQueryMethod, q)
+	if err != nil {
+		return err
+	}
+	return checkOK(data)
+}
+
+// SetMyCommands sets the command menu users see in chats of the given scope.
+// An empty lang sets the menu for users without a dedicated translation.
+func (c *Client) SetMyCommands(commands []BotCommand, scope BotCommandScope, lang string) (err error) {
+	defer func() { err = e.WrapIfErr("can't set commands", err) }()
+
+	cmds, err := json.Marshal(commands)
+	if err != nil {
+		return err
+	}
+	sc, err := json.Marshal(scope)
+	if err != nil {
+		return err
+	}
+
+	q := url.Values{}
+
+	q.Add("commands", string(cmds))
+	q.Add("scope", string(sc))
+	if lang != "" {
+		q.Add("language_code", lang)
+	}
+
+	data, err := c.doRequest(setMyCommandsMethod, q)
+	if err != nil {
+		return err
+	}
+	return checkOK(data)
+}
+
+func addKeyboard(q url.Values, kb *InlineKeyboardMarkup) error {
+	if kb == nil {
+		return nil
+	}
+	data, err := json.Marshal(kb)
+	if err != nil {
+		return err
+	}
+	q.Add("reply_markup", string(data))
+	return nil
+}
+
+// SendPhoto sends a photo Telegram already has, by its file_id
+func (c *Client) SendPhoto(chatID int, fileID, caption string, mode ParseMode) error {
+	return e.WrapIfErr("can't send photo", c.sendFile(sendPhotoMethod, "photo", chatID, fileID, caption, mode))
+}
+
+// SendVoice sends a voice note Telegram already has, by its file_id
+func (c *Client) SendVoice(chatID int, fileID, caption string, mode ParseMode) error {
+	return e.WrapIfErr("can't send voice", c.sendFile(sendVoiceMethod, "voice", chatID, fileID, caption, mode))
+}
+
+// SendAudio sends an audio file Telegram already has, by its file_id
+func (c *Client) SendAudio(chatID int, fileID, caption string, mode ParseMode) error {
+	return e.WrapIfErr("can't send audio", c.sendFile(sendAudioMethod, "audio", chatID, fileID, caption, mode))
+}
+
+// UploadPhoto sends a photo from local data
+func (c *Client) UploadPhoto(chatID int, fileName string, data []byte, caption string, mode ParseMode) error {
+	return e.WrapIfErr("can't upload photo", c.uploadFile(sendPhotoMethod, "photo", chatID, fileName, data, caption, mode))
+}
+
+// UploadVoice sends a voice note from local data
+func (c *Client) UploadVoice(chatID int, fileName string, data []byte, caption string, mode ParseMode) error {
+	return e.WrapIfErr("can't upload voice", c.uploadFile(sendVoiceMethod, "voice", chatID, fileName, data, caption, mode))
+}
+
+// UploadAudio sends an audio file from local data
+func (c *Client) UploadAudio(chatID int, fileName string, data []byte, caption string, mode ParseMode) error {
+	return e.WrapIfErr("can't upload audio", c.uploadFile(sendAudioMethod, "audio", chatID, fileName, data, caption, mode))
+}
+
+// sendFile calls one of the send<Media> methods with a known file_id
+func (c *Client) sendFile(method, field string, chatID int, fileID, caption string, mode ParseMode) error {
+	q := url.Values{}
+
+	q.Add("chat_id", strconv.Itoa(chatID))
+	q.Add(field, fileID)
+	if caption != "" {
+		q.Add("caption", caption)
+		addParseMode(q, mode)
+	}
+
+	data, err := c.doRequest(method, q)
+	if err != nil {
+		return err
+	}
+	return checkOK(data)
+}
+
+// uploadFile calls one of the send<Media> methods with the file itself
+func (c *Client) uploadFile(method, field string, chatID int, fileName string, file []byte, caption string, mode ParseMode) error {
 	q := url.Values{}
 
-	q.Add("chat_id", strconv.Itoa(chatId))
-	q.Add("text", text)
+	q.Add("chat_id", strconv.Itoa(chatID))
+	if caption != "" {
+		q.Add("caption", caption)
+		addParseMode(q, mode)
+	}
 
-	_, err := c.doRequest(sendMessageMethod, q)
+	data, err := c.doUpload(method, q, field, fileName, file)
 	if err != nil {
-		return e.Wrap("can't send message", err)
+		return err
+	}
+	return checkOK(data)
+}
+
+func addParseMode(q url.Values, mode ParseMode) {
+	if mode != ModePlain {
+		q.Add("parse_mode", string(mode))
+	}
+}
+
+// checkOK turns an "ok": false answer into an error carrying Telegram's description
+func checkOK(data []byte) error {
+	var res Response
+
+	if err := json.Unmarshal(data, &res); err != nil {
+		return err
+	}
+	if !res.OK {
+		return &APIError{Code: res.ErrorCode, Description: res.Description}
 	}
 	return nil
 }
 
+// doUpload posts fields and a single file as multipart/form-data
+func (c *Client) doUpload(method string, fields url.Values, fileField, fileName string, file []byte) (data []byte, err error) {
+	defer func() { err = e.WrapIfErr("can't do upload", err) }()
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for k, vs := range fields {
+		for _, v := range vs {
+			if err := w.WriteField(k, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	part, err := w.CreateFormFile(fileField, fileName)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(file); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	u := url.URL{
+		Scheme: "https",
+		Host:   c.host,
+		Path:   path.Join(c.basePath, method),
+	}
+
+	start := time.Now()
+	resp, err := c.client.Post(u.String(), w.FormDataContentType(), &body)
+	observe(method, start, resp, err)
+	if err != nil {
+		return nil, withoutURL(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	return io.ReadAll(resp.Body)
+}
+
+// withoutURL drops the request URL from a transport error. The URL holds
+// the bot token and, in the query, the text of messages, and the error ends
+// up in logs and dead letters.
+func withoutURL(err error) error {
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		return fmt.Errorf("%s: %w", uerr.Op, uerr.Err)
+	}
+	return err
+}
+
 func (c *Client) doRequest(method string, query url.Values) (data []byte, err error) {
 	defer func() { err = e.WrapIfErr("can't do request", err) }()
 
@@ -80,10 +473,12 @@ func (c *Client) doRequest(method string, query url.Values) (data []byte, err er
 
 	req.URL.RawQuery = query.Encode()
 
+	start := time.Now()
 	resp, err := c.client.Do(req)
+	observe(method, start, resp, err)
 
 	if err != nil {
-		return nil, err
+		return nil, withoutURL(err)
 	}
 
 	defer func() { _ = resp.Body.Close() }()
@@ -0,0 +1,63 @@
+package telegram
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testClient returns a client of a fake Bot API served by h
+func testClient(t *testing.T, h http.HandlerFunc) *Client {
+	t.Helper()
+
+	srv := httptest.NewTLSServer(h)
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New(u.Host, "token", time.Second)
+	c.client.Transport = srv.Client().Transport
+	return c
+}
+
+func TestUpdatesNotOK(t *testing.T) {
+	c := testClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+		_, _ = w.Write([]byte(`{"ok":false,"error_code":409,"description":"Conflict: terminated by other getUpdates request"}`))
+	})
+
+	updates, err := c.Updates(0, 100)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusConflict {
+		t.Fatalf("want a 409 API error, got %v", err)
+	}
+	if updates != nil {
+		t.Errorf("want no updates, got %v", updates)
+	}
+}
+
+func TestErrorsHideURL(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+
+	c := New(u.Host, "secret-token", time.Second)
+	err = c.SendMessage(1, "my card text")
+	if err == nil {
+		t.Fatal("want an error from a closed server")
+	}
+	for _, leak := range []string{"secret-token", "card"} {
+		if strings.Contains(err.Error(), leak) {
+			t.Errorf("error %q contains %q", err, leak)
+		}
+	}
+}
@@ -1,8 +1,26 @@
 package telegram
 
 type Update struct {
-	ID      int              `json:"update_id"`
-	Message *IncomingMessage `json:"message"`
+	ID            int              `json:"update_id"`
+	Message       *IncomingMessage `json:"message"`
+	CallbackQuery *CallbackQuery   `json:"callback_query"`
+}
+
+// CallbackQuery is a press of an inline button
+type CallbackQuery struct {
+	ID      string           `json:"id"`
+	From    From             `json:"from"`
+	Message *IncomingMessage `json:"message"` // the message with the button
+	Data    string           `json:"data"`
+}
+
+type InlineKeyboardMarkup struct {
+	InlineKeyboard [][]InlineKeyboardButton `json:"inline_keyboard"`
+}
+
+type InlineKeyboardButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data"`
 }
 
 type UpdatesResponse struct {
@@ -11,15 +29,113 @@ type UpdatesResponse struct {
 }
 
 type IncomingMessage struct {
-	Text string `json:"text"`
-	From From   `json:"from"`
-	Chat Chat   `json:"chat"`
+	MessageID int         `json:"message_id"`
+	Text      string      `json:"text"`
+	Caption   string      `json:"caption"`
+	From      From        `json:"from"`
+	Chat      Chat        `json:"chat"`
+	Document  *Document   `json:"document"`
+	Photo     []PhotoSize `json:"photo"` // sizes of the same photo, smallest first
+	Voice     *Voice      `json:"voice"`
+	Audio     *Audio      `json:"audio"`
+}
+
+type PhotoSize struct {
+	FileID   string `json:"file_id"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	FileSize int    `json:"file_size"`
+}
+
+// Voice is a voice note recorded in Telegram
+type Voice struct {
+	FileID   string `json:"file_id"`
+	Duration int    `json:"duration"`
+	MimeType string `json:"mime_type"`
+	FileSize int    `json:"file_size"`
+}
+
+// Audio is a music file sent as audio
+type Audio struct {
+	FileID    string `json:"file_id"`
+	Duration  int    `json:"duration"`
+	Performer string `json:"performer"`
+	Title     string `json:"title"`
+	FileName  string `json:"file_name"`
+	MimeType  string `json:"mime_type"`
+	FileSize  int    `json:"file_size"`
+}
+
+type Document struct {
+	FileID   string `json:"file_id"`
+	FileName string `json:"file_name"`
+	MimeType string `json:"mime_type"`
+	FileSize int    `json:"file_size"`
 }
 
 type From struct {
-	UserName string `json:"username"`
+	ID           int    `json:"id"`
+	UserName     string `json:"username"`
+	FirstName    string `json:"first_name"`
+	LanguageCode string `json:"language_code"`
 }
 
 type Chat struct {
-	ID int `json:"id"`
+	ID   int    `json:"id"`
+	Type string `json:"type"` // "private", "group", "supergroup" or "channel"
+}
+
+type User struct {
+	ID       int    `json:"id"`
+	IsBot    bool   `json:"is_bot"`
+	UserName string `json:"username"`
 }
+
+type MeResponse struct {
+	OK     bool `json:"ok"`
+	Result User `json:"result"`
+}
+
+type ChatMember struct {
+	Status string `json:"status"` // "creator", "administrator", "member", …
+}
+
+type ChatMemberResponse struct {
+	OK     bool       `json:"ok"`
+	Result ChatMember `json:"result"`
+}
+
+type File struct {
+	FileID   string `json:"file_id"`
+	FileSize int    `json:"file_size"`
+	FilePath string `json:"file_path"`
+}
+
+type FileResponse struct {
+	OK     bool `json:"ok"`
+	Result File `json:"result"`
+}
+
+// Response is the envelope of Bot API answers whose result isn't needed
+type Response struct {
+	OK          bool   `json:"ok"`
+	ErrorCode   int    `json:"error_code"`
+	Description string `json:"description"`
+}
+
+// BotCommand is an entry of the bot's command menu
+type BotCommand struct {
+	Command     string `json:"command"` // without the leading slash
+	Description string `json:"description"`
+}
+
+// BotCommandScope picks the chats a command menu is shown in
+type BotCommandScope struct {
+	Type string `json:"type"`
+}
+
+var (
+	ScopeDefault      = BotCommandScope{Type: "default"}
+	ScopePrivateChats = BotCommandScope{Type: "all_private_chats"}
+	ScopeGroupChats   = BotCommandScope{Type: "all_group_chats"}
+)
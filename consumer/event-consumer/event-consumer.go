@@ -1,59 +1,178 @@
 package eventconsumer
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
 	"time"
 
 	"flashcard/events"
 )
 
+const (
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+
+	maxAttempts = 3                      // tries per event before it's a dead letter
+	retryDelay  = 500 * time.Millisecond // wait before the second try, doubled after
+)
+
 type Consumer struct {
-	fetcher   events.Fetcher
-	processor events.Processor
-	batchSize int
+	fetcher     events.Fetcher
+	processor   events.Processor
+	deadLetters events.DeadLetters // nil drops failed events
+	batchSize   int
+	status      *status
+}
+
+// status is what health checks read about the loop, shared by all copies
+// of a Consumer. Times are unix nanoseconds.
+type status struct {
+	lastFetch atomic.Int64 // last successful fetch
+	lastBeat  atomic.Int64 // the loop last started a fetch or finished an attempt at an event
+	busySince atomic.Int64 // the current attempt at an event started, 0 between events
+}
+
+func New(fetcher events.Fetcher, processor events.Processor, deadLetters events.DeadLetters, batchSize int) Consumer {
+	c := Consumer{
+		fetcher:     fetcher,
+		processor:   processor,
+		deadLetters: deadLetters,
+		batchSize:   batchSize,
+		status:      &status{},
+	}
+	// not started yet isn't stuck
+	c.beat()
+
+	return c
+}
+
+// LastFetch returns when events were last fetched successfully, or the
+// zero time if never. Fetchers return an error for any answer that isn't
+// a success, so this only moves while the source really answers.
+func (c Consumer) LastFetch() time.Time {
+	return unixTime(c.status.lastFetch.Load())
+}
+
+// Stuck reports why the loop seems to hang, or nil if it doesn't.
+//
+// While an event is processed the loop can't beat, so a single attempt
+// may take up to busy, the longest processing of any event. Between events
+// a fetch takes up to the fetcher's long poll and a failed one is followed
+// by up to maxBackoff of waiting, so idle must cover both.
+func (c Consumer) Stuck(idle, busy time.Duration) error {
+	if since := c.status.busySince.Load(); since != 0 {
+		if took := time.Since(unixTime(since)); took > busy {
+			return fmt.Errorf("processing an event for %s", took.Round(time.Second))
+		}
+		return nil
+	}
+
+	if ago := time.Since(unixTime(c.status.lastBeat.Load())); ago > idle {
+		return fmt.Errorf("last loop beat was %s ago", ago.Round(time.Second))
+	}
+	return nil
+}
+
+func (c Consumer) beat() {
+	c.status.lastBeat.Store(time.Now().UnixNano())
 }
 
-func New(fetcher events.Fetcher, processor events.Processor, batchSize int) Consumer {
-	return Consumer{
-		fetcher:   fetcher,
-		processor: processor,
-		batchSize: batchSize,
+func unixTime(nanos int64) time.Time {
+	if nanos == 0 {
+		return time.Time{}
 	}
+	return time.Unix(0, nanos)
 }
 
+// Start polls for events forever. The fetcher is expected to long poll, so
+// an empty batch is fetched again right away; after a failed fetch the
+// consumer waits, twice as long after every failure in a row.
 func (c Consumer) Start() error {
+	backoff := time.Duration(0)
+
 	for {
+		c.beat()
+
 		gotEvents, err := c.fetcher.Fetch(c.batchSize)
 		if err != nil {
-			log.Printf("[ERR] consumer: %s", err.Error())
+			backoff = nextBackoff(backoff)
+			slog.Error("can't fetch events", "retry_in", backoff, "error", err)
+
+			time.Sleep(backoff)
 
 			continue
 		}
+		backoff = 0
+		c.status.lastFetch.Store(time.Now().UnixNano())
 
 		if len(gotEvents) == 0 {
-			time.Sleep(1 * time.Second)
-
 			continue
 		}
 
 		if err := c.handleEvents(gotEvents); err != nil {
-			log.Print(err)
+			slog.Error("can't handle events", "error", err)
 
 			continue
 		}
 	}
 }
 
+// nextBackoff doubles the previous wait between minBackoff and maxBackoff
+func nextBackoff(prev time.Duration) time.Duration {
+	if prev < minBackoff {
+		return minBackoff
+	}
+	if prev*2 > maxBackoff {
+		return maxBackoff
+	}
+	return prev * 2
+}
+
 func (c *Consumer) handleEvents(events []events.Event) error {
 	for _, event := range events {
-		log.Printf("got new event: %s", event.Text)
+		c.handleEvent(event)
+	}
+
+	return nil
+}
 
-		if err := c.processor.Process(event); err != nil {
-			log.Printf("can't handle event: %s", err.Error())
+// handleEvent processes an event, retrying errors that may be transient,
+// e.g. a locked database or a network failure. An event that still fails
+// goes to the dead letters.
+func (c *Consumer) handleEvent(event events.Event) {
+	var (
+		err      error
+		attempts int
+		delay    = retryDelay
+	)
+	for attempts < maxAttempts {
+		attempts++
 
-			continue
+		c.status.busySince.Store(time.Now().UnixNano())
+		err = c.processor.Process(event)
+		c.status.busySince.Store(0)
+		c.beat()
+
+		if err == nil {
+			return
+		}
+		if errors.Is(err, events.ErrPermanent) || attempts == maxAttempts {
+			break
 		}
+
+		slog.Warn("can't handle event, retrying", "update", event.ID, "retry_in", delay, "error", err)
+		time.Sleep(delay)
+		delay *= 2
 	}
 
-	return nil
+	slog.Error("can't handle event", "update", event.ID, "attempts", attempts, "error", err)
+
+	if c.deadLetters == nil {
+		return
+	}
+	if err := c.deadLetters.DeadLetter(event, attempts, err); err != nil {
+		slog.Error("can't keep dead letter", "update", event.ID, "error", err)
+	}
 }
@@ -0,0 +1,70 @@
+package eventconsumer
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"flashcard/events"
+)
+
+type fetcherFunc func(limit int) ([]events.Event, error)
+
+func (f fetcherFunc) Fetch(limit int) ([]events.Event, error) {
+	return f(limit)
+}
+
+func TestFailedFetchIsNotAFetch(t *testing.T) {
+	fetched := make(chan struct{}, 1)
+	fetch := fetcherFunc(func(int) ([]events.Event, error) {
+		select {
+		case fetched <- struct{}{}:
+		default:
+		}
+		return nil, errors.New("401 Unauthorized")
+	})
+	c := New(fetch, events.ProcessorFunc(func(events.Event) error { return nil }), nil, 1)
+
+	go func() { _ = c.Start() }()
+	<-fetched
+
+	if last := c.LastFetch(); !last.IsZero() {
+		t.Errorf("failed fetch counted as successful at %s", last)
+	}
+}
+
+func TestStuck(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	slow := events.ProcessorFunc(func(events.Event) error {
+		close(started)
+		<-release
+		return nil
+	})
+	c := New(nil, slow, nil, 1)
+
+	go c.handleEvent(events.Event{ID: 1})
+	<-started
+	defer close(release)
+
+	time.Sleep(20 * time.Millisecond)
+
+	// a long event isn't a hanging loop as long as it's within busy
+	if err := c.Stuck(time.Millisecond, time.Hour); err != nil {
+		t.Errorf("busy loop reported stuck: %v", err)
+	}
+	if err := c.Stuck(time.Hour, time.Millisecond); err == nil {
+		t.Error("event running longer than busy wasn't reported")
+	}
+}
+
+func TestStuckIdle(t *testing.T) {
+	c := New(nil, nil, nil, 1)
+
+	if err := c.Stuck(time.Hour, time.Hour); err != nil {
+		t.Errorf("fresh consumer reported stuck: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err := c.Stuck(time.Millisecond, time.Hour); err == nil {
+		t.Error("loop without beats wasn't reported")
+	}
+}
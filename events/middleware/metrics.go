@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"time"
+
+	"flashcard/events"
+	"flashcard/lib/metrics"
+)
+
+var (
+	errorsTotal = metrics.Default.Counter(
+		"flashcard_processing_errors_total",
+		"Events whose processing failed, by type. Retries count again.",
+		"type",
+	)
+	rateLimited = metrics.Default.Counter(
+		"flashcard_rate_limited_total",
+		"Events dropped because their sender sent too many.",
+	)
+	processingLatency = metrics.Default.Histogram(
+		"flashcard_processing_duration_seconds",
+		"Time processing an event took, by type.",
+		metrics.DefBuckets,
+		"type",
+	)
+)
+
+func init() {
+	metrics.Default.CounterFunc(
+		"flashcard_panics_total",
+		"Panics recovered while processing events.",
+		func() float64 { return float64(Panics()) },
+	)
+}
+
+// Metrics counts errors and measures how long processing took. It sees
+// every attempt at an event, so events received are counted where they
+// are fetched instead.
+func Metrics() Middleware {
+	return func(next events.Processor) events.Processor {
+		return events.ProcessorFunc(func(e events.Event) error {
+			typ := e.Type.String()
+
+			start := time.Now()
+			err := next.Process(e)
+			processingLatency.Observe(time.Since(start).Seconds(), typ)
+
+			if err != nil {
+				errorsTotal.Inc(typ)
+			}
+			return err
+		})
+	}
+}
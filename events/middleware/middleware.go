@@ -0,0 +1,95 @@
+// Package middleware wraps an events.Processor with behaviour wanted
+// around every event, whatever the event source.
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"flashcard/events"
+	"flashcard/lib/logging"
+)
+
+// Middleware returns a Processor that does something around next
+type Middleware func(next events.Processor) events.Processor
+
+// Chain wraps p in mws. The first middleware is the outermost, so it sees
+// an event first and its result last.
+func Chain(p events.Processor, mws ...Middleware) events.Processor {
+	for i := len(mws) - 1; i >= 0; i-- {
+		p = mws[i](p)
+	}
+	return p
+}
+
+var panics atomic.Int64
+
+// Panics returns how many panics Recover caught since the start
+func Panics() int64 {
+	return panics.Load()
+}
+
+// Recover turns a panic while processing an event into a permanent error,
+// so one bad event doesn't stop the consumer. The stack and the event are
+// logged, then onPanic, if not nil, may tell the sender that it failed.
+func Recover(onPanic func(e events.Event)) Middleware {
+	return func(next events.Processor) events.Processor {
+		return events.ProcessorFunc(func(e events.Event) (err error) {
+			defer func() {
+				r := recover()
+				if r == nil {
+					return
+				}
+				panics.Add(1)
+				slog.Error("panic while processing event", "update", e.ID, "panic", r,
+					"stack", string(debug.Stack()), logging.Content("event", string(e.Raw)))
+				err = events.Permanent(fmt.Errorf("panic: %v", r))
+
+				if onPanic != nil {
+					notify(onPanic, e)
+				}
+			}()
+			return next.Process(e)
+		})
+	}
+}
+
+// notify calls onPanic, which may well panic on the same broken event
+func notify(onPanic func(e events.Event), e events.Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("panic while reporting a panic", "update", e.ID, "panic", r)
+		}
+	}()
+	onPanic(e)
+}
+
+// Logging logs every event before it is processed. attrs returns the
+// fields that identify an event, e.g. its update, chat and user; the
+// event's text is logged as content.
+func Logging(attrs func(events.Event) []any) Middleware {
+	return func(next events.Processor) events.Processor {
+		return events.ProcessorFunc(func(e events.Event) error {
+			args := append(attrs(e), "type", e.Type.String(), logging.Content("text", e.Text))
+			slog.Info("got new event", args...)
+			return next.Process(e)
+		})
+	}
+}
+
+// Timing logs events that took longer than slow to process
+func Timing(slow time.Duration) Middleware {
+	return func(next events.Processor) events.Processor {
+		return events.ProcessorFunc(func(e events.Event) error {
+			start := time.Now()
+			err := next.Process(e)
+			if took := time.Since(start); took > slow {
+				slog.Warn("slow event", "update", e.ID, "took", took)
+			}
+			return err
+		})
+	}
+}
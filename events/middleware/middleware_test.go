@@ -0,0 +1,194 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"flashcard/events"
+	"flashcard/lib/logging"
+	"flashcard/lib/metrics"
+)
+
+// record returns a middleware that notes when an event goes in and out
+func record(name string, calls *[]string) Middleware {
+	return func(next events.Processor) events.Processor {
+		return events.ProcessorFunc(func(e events.Event) error {
+			*calls = append(*calls, name+" in")
+			err := next.Process(e)
+			*calls = append(*calls, name+" out")
+			return err
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	tests := []struct {
+		name string
+		mws  []string
+		want []string
+	}{
+		{name: "none", want: []string{"process"}},
+		{name: "one", mws: []string{"a"}, want: []string{"a in", "process", "a out"}},
+		{
+			name: "first is outermost",
+			mws:  []string{"a", "b", "c"},
+			want: []string{"a in", "b in", "c in", "process", "c out", "b out", "a out"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			p := events.ProcessorFunc(func(events.Event) error {
+				calls = append(calls, "process")
+				return nil
+			})
+
+			var mws []Middleware
+			for _, name := range tt.mws {
+				mws = append(mws, record(name, &calls))
+			}
+			if err := Chain(p, mws...).Process(events.Event{ID: 1}); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(calls, tt.want) {
+				t.Errorf("got %q, want %q", calls, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecover(t *testing.T) {
+	tests := []struct {
+		name        string
+		panics      bool
+		onPanic     bool // pass an onPanic
+		onPanicFail bool // which panics as well
+	}{
+		{name: "no panic", onPanic: true},
+		{name: "panic", panics: true, onPanic: true},
+		{name: "panic without onPanic", panics: true},
+		{name: "onPanic panics too", panics: true, onPanic: true, onPanicFail: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := events.ProcessorFunc(func(events.Event) error {
+				if tt.panics {
+					panic("boom")
+				}
+				return nil
+			})
+			var reported []int
+			var onPanic func(events.Event)
+			if tt.onPanic {
+				onPanic = func(e events.Event) {
+					reported = append(reported, e.ID)
+					if tt.onPanicFail {
+						panic("again")
+					}
+				}
+			}
+
+			before := Panics()
+			err := Recover(onPanic)(next).Process(events.Event{ID: 7})
+
+			if !tt.panics {
+				if err != nil || Panics() != before || reported != nil {
+					t.Errorf("got %v, %d panics and reports %v", err, Panics()-before, reported)
+				}
+				return
+			}
+			if !errors.Is(err, events.ErrPermanent) {
+				t.Errorf("got %v, want a permanent error", err)
+			}
+			if Panics() != before+1 {
+				t.Errorf("counted %d panics, want 1", Panics()-before)
+			}
+			if tt.onPanic && !reflect.DeepEqual(reported, []int{7}) {
+				t.Errorf("reported %v, want update 7", reported)
+			}
+		})
+	}
+}
+
+func TestLogging(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(logging.New(&buf, slog.LevelInfo, false, false))
+
+	attrs := func(e events.Event) []any { return []any{"update", e.ID} }
+	called := false
+	p := Logging(attrs)(events.ProcessorFunc(func(events.Event) error {
+		called = true
+		return nil
+	}))
+
+	if err := p.Process(events.Event{ID: 42, Type: events.Message, Text: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if !called {
+		t.Error("the event wasn't passed on")
+	}
+
+	got := buf.String()
+	for _, want := range []string{"got new event", "update=42", "type=" + events.Message.String(), "text=\"[6 chars]\""} {
+		if !strings.Contains(got, want) {
+			t.Errorf("log %q lacks %q", got, want)
+		}
+	}
+	if strings.Contains(got, "secret") {
+		t.Errorf("log %q shows the text", got)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	fail := errors.New("fail")
+	p := Metrics()(events.ProcessorFunc(func(e events.Event) error {
+		if e.ID%2 == 0 {
+			return fail
+		}
+		return nil
+	}))
+
+	typ := events.Callback.String()
+	errorsBefore := metricValue(t, `flashcard_processing_errors_total{type="`+typ+`"}`)
+	countBefore := metricValue(t, `flashcard_processing_duration_seconds_count{type="`+typ+`"}`)
+
+	for id := 1; id <= 4; id++ {
+		if err := p.Process(events.Event{ID: id, Type: events.Callback}); (err != nil) != (id%2 == 0) {
+			t.Errorf("update %d: got %v", id, err)
+		}
+	}
+
+	if got := metricValue(t, `flashcard_processing_errors_total{type="`+typ+`"}`) - errorsBefore; got != 2 {
+		t.Errorf("counted %v errors, want 2", got)
+	}
+	if got := metricValue(t, `flashcard_processing_duration_seconds_count{type="`+typ+`"}`) - countBefore; got != 4 {
+		t.Errorf("timed %v events, want 4", got)
+	}
+}
+
+func metricValue(t *testing.T, sample string) float64 {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	metrics.Default.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if v, ok := strings.CutPrefix(line, sample+" "); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return f
+		}
+	}
+	return 0
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"flashcard/events"
+)
+
+// ErrRateLimited is why an event was dropped by RateLimit
+var ErrRateLimited = errors.New("sender is rate limited")
+
+// RateLimit drops events of a sender who sent more than limit events within
+// the current window of length per. key names the sender of an event; events
+// with an empty key are never limited.
+//
+// A dropped event fails with a permanent ErrRateLimited, so it is not retried
+// but kept as a dead letter that can be replayed. An event retried by the
+// consumer counts once: it is let through or dropped as it was the first time.
+func RateLimit(limit int, per time.Duration, key func(events.Event) string) Middleware {
+	l := &limiter{
+		limit:   limit,
+		per:     per,
+		counts:  make(map[string]int),
+		allowed: make(map[int]bool),
+	}
+
+	return func(next events.Processor) events.Processor {
+		return events.ProcessorFunc(func(e events.Event) error {
+			k := key(e)
+			if k != "" && !l.allow(k, e.ID, time.Now()) {
+				rateLimited.Inc()
+				slog.Warn("rate limit: dropped event", "update", e.ID, "sender", k)
+				return events.Permanent(ErrRateLimited)
+			}
+			return next.Process(e)
+		})
+	}
+}
+
+// limiter counts events per key in fixed windows. Counts are forgotten when
+// a window ends, so the maps only hold keys and events seen recently.
+type limiter struct {
+	mu      sync.Mutex
+	limit   int
+	per     time.Duration
+	start   time.Time // of the current window
+	counts  map[string]int
+	allowed map[int]bool // what was decided for the events of the window
+}
+
+func (l *limiter) allow(key string, id int, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.start) >= l.per {
+		l.start = now
+		clear(l.counts)
+		clear(l.allowed)
+	}
+
+	if ok, seen := l.allowed[id]; seen {
+		return ok
+	}
+	l.counts[key]++
+	l.allowed[id] = l.counts[key] <= l.limit
+	return l.allowed[id]
+}
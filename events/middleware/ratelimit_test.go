@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"flashcard/events"
+)
+
+func TestLimiter(t *testing.T) {
+	type call struct {
+		key  string
+		id   int
+		at   time.Duration // since the first call
+		want bool
+	}
+
+	tests := []struct {
+		name  string
+		calls []call
+	}{
+		{
+			name: "over the limit",
+			calls: []call{
+				{"alice", 1, 0, true},
+				{"alice", 2, time.Second, true},
+				{"alice", 3, 2 * time.Second, false},
+			},
+		},
+		{
+			name: "senders apart",
+			calls: []call{
+				{"alice", 1, 0, true},
+				{"alice", 2, 0, true},
+				{"bob", 3, 0, true},
+				{"alice", 4, 0, false},
+			},
+		},
+		{
+			name: "window reset",
+			calls: []call{
+				{"alice", 1, 0, true},
+				{"alice", 2, 0, true},
+				{"alice", 3, 59 * time.Second, false},
+				{"alice", 4, time.Minute, true},
+				{"alice", 5, time.Minute, true},
+				{"alice", 6, time.Minute, false},
+			},
+		},
+		{
+			name: "retries count once",
+			calls: []call{
+				{"alice", 1, 0, true},
+				{"alice", 1, time.Second, true},
+				{"alice", 1, 2 * time.Second, true},
+				{"alice", 2, 3 * time.Second, true},
+				{"alice", 3, 3 * time.Second, false},
+				{"alice", 3, 4 * time.Second, false},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &limiter{limit: 2, per: time.Minute, counts: make(map[string]int), allowed: make(map[int]bool)}
+			start := time.Now()
+			for i, c := range tt.calls {
+				if got := l.allow(c.key, c.id, start.Add(c.at)); got != c.want {
+					t.Errorf("call %d (%s, update %d): allowed %v, want %v", i, c.key, c.id, got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	var processed []int
+	p := RateLimit(1, time.Hour, func(e events.Event) string { return e.Text })(events.ProcessorFunc(func(e events.Event) error {
+		processed = append(processed, e.ID)
+		return errors.New("locked")
+	}))
+
+	limitedBefore := metricValue(t, "flashcard_rate_limited_total")
+
+	// a failed event is retried, then the sender sends another one
+	for _, e := range []events.Event{{ID: 1, Text: "alice"}, {ID: 1, Text: "alice"}, {ID: 2, Text: "alice"}, {ID: 3}, {ID: 4}} {
+		err := p.Process(e)
+		if e.ID == 2 {
+			if !errors.Is(err, ErrRateLimited) || !errors.Is(err, events.ErrPermanent) {
+				t.Errorf("update 2: got %v, want a permanent ErrRateLimited", err)
+			}
+			continue
+		}
+		if err == nil || errors.Is(err, ErrRateLimited) {
+			t.Errorf("update %d: got %v, want the processor's error", e.ID, err)
+		}
+	}
+
+	if want := []int{1, 1, 3, 4}; !reflect.DeepEqual(processed, want) {
+		t.Errorf("processed %v, want %v", processed, want)
+	}
+	if got := metricValue(t, "flashcard_rate_limited_total") - limitedBefore; got != 1 {
+		t.Errorf("counted %v dropped events, want 1", got)
+	}
+}
@@ -0,0 +1,205 @@
+package telegram
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrUnterminatedQuote is returned when a quoted argument is never closed
+var ErrUnterminatedQuote = errors.New("unterminated quote")
+
+// ErrBadOption is returned for a session option that can't be parsed
+var ErrBadOption = errors.New("bad session option")
+
+// command is a parsed "/cmd arg1 arg2" message
+type command struct {
+	name    string   // e.g. "/get"
+	mention string   // bot name from "/get@BotName", if any
+	args    []string // split arguments
+	rawArgs string   // everything after the command, untouched
+	from    Meta     // who sent it and where
+}
+
+// dialogKey identifies the sender's dialogs
+func (c command) dialogKey() dialogKey {
+	return dialogKey{chatID: c.from.ChatID, userID: c.from.UserID}
+}
+
+// parseCommand splits a message into a command and its arguments.
+// ok is false if the text is not a command at all.
+func parseCommand(text string) (cmd command, ok bool, err error) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "/") {
+		return command{}, false, nil
+	}
+
+	name, rest := text, ""
+	if i := strings.IndexFunc(text, unicode.IsSpace); i >= 0 {
+		name, rest = text[:i], text[i:]
+	}
+
+	name, mention, _ := strings.Cut(name, "@")
+
+	cmd = command{
+		name:    strings.ToLower(name),
+		mention: mention,
+		rawArgs: strings.TrimSpace(rest),
+	}
+	cmd.args, err = splitArgs(cmd.rawArgs)
+	if err != nil {
+		return command{}, true, err
+	}
+	return cmd, true, nil
+}
+
+// splitArgs splits s on whitespace, keeping "quoted" parts together so
+// deck names may contain spaces.
+func splitArgs(s string) ([]string, error) {
+	var (
+		args    []string
+		cur     strings.Builder
+		quote   rune
+		inToken bool
+	)
+	for _, r := range s {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			cur.WriteRune(r)
+		case r == '"' || r == '“':
+			quote = r
+			if r == '“' {
+				quote = '”'
+			}
+			inToken = true
+		case unicode.IsSpace(r):
+			if inToken {
+				args = append(args, cur.String())
+				cur.Reset()
+				inToken = false
+			}
+		default:
+			cur.WriteRune(r)
+			inToken = true
+		}
+	}
+	if quote != 0 {
+		return nil, ErrUnterminatedQuote
+	}
+	if inToken {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
+
+// joinArgs turns split arguments back into a single name
+func joinArgs(args []string) string {
+	return strings.TrimSpace(strings.Join(args, " "))
+}
+
+// order of the cards in a quiz session
+type order int
+
+const (
+	orderSequential order = iota
+	orderShuffle
+)
+
+// sessionOptions control which cards a quiz session asks and in what order
+type sessionOptions struct {
+	order     order
+	seed      int64 // only used with orderShuffle
+	hasSeed   bool  // seed was given explicitly
+	limit     int   // 0 means all cards
+	onlyWrong bool  // only cards answered wrong last time
+	onlyDue   bool  // only cards due for review
+}
+
+// parseSessionArgs reads "<name> [sequential|shuffle] [seed=N] [N] [wrong] [due]".
+// Options are recognised from the end, so the deck name may contain spaces
+// even without quotes. When the name left over isn't a deck, longer names
+// are tried, so "Spanish 2" or "verbs due" still find decks called so.
+func parseSessionArgs(args []string, isDeck func(name string) bool) (string, sessionOptions, error) {
+	end := optionsStart(args)
+	name, opts, err := sessionArgsAt(args, end)
+	if err == nil && isDeck(name) {
+		return name, opts, nil
+	}
+
+	for i := end + 1; i <= len(args); i++ {
+		if n, o, err := sessionArgsAt(args, i); err == nil && isDeck(n) {
+			return n, o, nil
+		}
+	}
+	return name, opts, err
+}
+
+// optionsStart finds where the options at the end of args begin, counting
+// malformed ones too so they are reported rather than taken as the name
+func optionsStart(args []string) int {
+	end := len(args)
+	for end > 1 {
+		var probe sessionOptions
+		matched, err := probe.apply(args[end-1])
+		if !matched && err == nil {
+			break
+		}
+		end--
+	}
+	return end
+}
+
+// sessionArgsAt reads args[:end] as the deck name and the rest as options
+func sessionArgsAt(args []string, end int) (string, sessionOptions, error) {
+	var opts sessionOptions
+	// read from the end, as options always were
+	for i := len(args) - 1; i >= end; i-- {
+		if _, err := opts.apply(args[i]); err != nil {
+			return "", sessionOptions{}, err
+		}
+	}
+	return joinArgs(args[:end]), opts, nil
+}
+
+// apply parses a single option token. It reports false if tok is not an option.
+func (o *sessionOptions) apply(tok string) (bool, error) {
+	tok = strings.ToLower(tok)
+	switch tok {
+	case "seq", "sequential", "ordered":
+		o.order = orderSequential
+		return true, nil
+	case "shuffle", "shuffled", "random":
+		o.order = orderShuffle
+		return true, nil
+	case "wrong", "mistakes":
+		o.onlyWrong = true
+		return true, nil
+	case "due":
+		o.onlyDue = true
+		return true, nil
+	}
+
+	if v, ok := strings.CutPrefix(tok, "seed="); ok {
+		seed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return false, ErrBadOption
+		}
+		o.order = orderShuffle
+		o.seed = seed
+		o.hasSeed = true
+		return true, nil
+	}
+
+	if n, err := strconv.Atoi(tok); err == nil {
+		if n <= 0 {
+			return false, ErrBadOption
+		}
+		o.limit = n
+		return true, nil
+	}
+
+	return false, nil
+}
@@ -0,0 +1,75 @@
+package telegram
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+		err  error
+	}{
+		{in: "", want: nil},
+		{in: "spanish", want: []string{"spanish"}},
+		{in: "  spanish \t shuffle\n10 ", want: []string{"spanish", "shuffle", "10"}},
+		{in: `"Spanish 2" due`, want: []string{"Spanish 2", "due"}},
+		{in: "“Spanish 2” due", want: []string{"Spanish 2", "due"}},
+		{in: `a"b c"d`, want: []string{"ab cd"}},
+		{in: `""`, want: []string{""}},
+		{in: "“it's \"fine\"”", want: []string{`it's "fine"`}},
+		{in: `"Spanish 2`, err: ErrUnterminatedQuote},
+		{in: "“Spanish 2\"", err: ErrUnterminatedQuote},
+	}
+
+	for _, tt := range tests {
+		got, err := splitArgs(tt.in)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("splitArgs(%q) error %v, want %v", tt.in, err, tt.err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitArgs(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseSessionArgs(t *testing.T) {
+	decks := map[string]bool{"French": true, "Spanish 2": true, "verbs": true, "verbs due": true, "irregular 10 due": true}
+	isDeck := func(name string) bool { return decks[name] }
+
+	tests := []struct {
+		args []string
+		name string
+		opts sessionOptions
+		err  error
+	}{
+		{args: []string{"French"}, name: "French"},
+		{args: []string{"French", "shuffle", "10"}, name: "French", opts: sessionOptions{order: orderShuffle, limit: 10}},
+		{args: []string{"French", "seed=42", "wrong"}, name: "French", opts: sessionOptions{order: orderShuffle, seed: 42, hasSeed: true, onlyWrong: true}},
+		{args: []string{"French", "shuffle", "seq"}, name: "French", opts: sessionOptions{order: orderShuffle}},
+		{args: []string{"Spanish", "2"}, name: "Spanish 2"},
+		{args: []string{"Spanish", "2", "due"}, name: "Spanish 2", opts: sessionOptions{onlyDue: true}},
+		{args: []string{"irregular", "10", "due"}, name: "irregular 10 due"},
+		// the shorter name wins when both are decks
+		{args: []string{"verbs", "due"}, name: "verbs", opts: sessionOptions{onlyDue: true}},
+		// unknown decks keep the options, so the reply is about the deck
+		{args: []string{"German", "5"}, name: "German", opts: sessionOptions{limit: 5}},
+		{args: []string{"due"}, name: "due"},
+		{args: []string{"French", "seed=x"}, err: ErrBadOption},
+		{args: []string{"French", "0"}, err: ErrBadOption},
+	}
+
+	for _, tt := range tests {
+		name, opts, err := parseSessionArgs(tt.args, isDeck)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%q: error %v, want %v", tt.args, err, tt.err)
+			continue
+		}
+		if name != tt.name || opts != tt.opts {
+			t.Errorf("%q: got %q %+v, want %q %+v", tt.args, name, opts, tt.name, tt.opts)
+		}
+	}
+}
@@ -3,75 +3,200 @@ package telegram
 import (
 	"context"
 	"errors"
-	"fmt"
-	"log"
+	"math/rand"
 	"strings"
+	"time"
 
+	"flashcard/clients/telegram"
 	"flashcard/lib/e"
+	"flashcard/lib/logging"
 	"flashcard/storage"
 )
 
 const (
-	SaveCmd   = "/save"
-	GetCmd    = "/get"
-	HelpCmd   = "/help"
-	StartCmd  = "/start"
-	ListCmd   = "/list"
-	DeleteCmd = "/delete"
-	NextCmd   = "/next"
+	SaveCmd        = "/save"
+	GetCmd         = "/get"
+	HelpCmd        = "/help"
+	StartCmd       = "/start"
+	ListCmd        = "/list"
+	DeleteCmd      = "/delete"
+	NextCmd        = "/next"
+	SettingsCmd    = "/settings"
+	CancelCmd      = "/cancel"
+	StatsCmd       = "/stats"
+	RemindCmd      = "/remind"
+	ShareCmd       = "/share"
+	CopyCmd        = "/copy"
+	SubscribeCmd   = "/subscribe"
+	UnshareCmd     = "/unshare"
+	LeaderboardCmd = "/leaderboard"
+	AddCmd         = "/add"
+	EditCmd        = "/edit"
+	ForkCmd        = "/fork"
+	UnsubscribeCmd = "/unsubscribe"
+	GenerateCmd    = "/generate"
+	LanguageCmd    = "/language"
 )
 
-func (p *Processor) doCmd(text string, chatID int, username string) error {
+// directionPrefix marks an optional line in saved Q&A text that sets the deck direction
+const directionPrefix = "direction:"
+
+func (p *Processor) doCmd(text string, meta Meta) error {
 	text = strings.TrimSpace(text)
-	log.Printf("got new command '%s' from '%s'", text, username)
+	p.logger.Debug("got new command", logging.Content("text", text))
+
+	chatID, owner := meta.ChatID, meta.owner()
+
+	key := dialogKey{chatID: chatID, userID: meta.UserID}
+
+	// a voice note has no caption, so its card may come in the next message
+	att := meta.Attachment
+	if d, ok := p.pending[key]; ok && d.step == stepAttach && att == nil {
+		if _, ok := attachMedia(text, *d.attachment); ok {
+			p.takePending(key)
+			if d.prev != nil {
+				d.prev.updated = time.Now()
+				p.pending[key] = d.prev
+			}
+			att = d.attachment
+		}
+	}
 
-	// 1) If chat is waiting for a name → treat text as the name
-	if st, ok := p.pendingSaveName[chatID]; ok {
-		delete(p.pendingSaveName, chatID)
-		return p.finishSave(chatID, username, st.rawQA, text)
+	// a file belongs to the card written along with it
+	if att != nil {
+		withMedia, ok := attachMedia(text, *att)
+		if !ok {
+			if meta.isGroup() {
+				return nil
+			}
+			prev, _ := p.takePending(key)
+			return p.ask(key, &dialog{step: stepAttach, attachment: att, prev: prev}, msgMediaWithoutCard)
+		}
+		text = withMedia
+		p.keepMedia(*att)
 	}
 
-	// 2) If chat is waiting for the QA → treat text as the raw QA
-	if _, ok := p.pendingSaveQA[chatID]; ok {
+	// 1) Commands always win over a pending dialog
+	cmd, isCmd, err := parseCommand(text)
+	if err != nil {
+		return p.send(chatID, msgBadArguments)
+	}
+	if isCmd {
+		cmd.from = meta
+		return p.route(chatID, owner, cmd)
+	}
+
+	// a file without a command in a private chat is material for new cards
+	if meta.Document != nil && !meta.isGroup() {
+		return p.route(chatID, owner, command{name: GenerateCmd, from: meta})
+	}
+
+	// 2) Otherwise the text answers the sender's pending dialog, if any
+	if d, ok := p.takePending(key); ok {
+		return p.answerDialog(key, owner, d, text)
+	}
+
+	// 3) A plain message during a quiz is an answer
+	if _, ok := p.sessions[chatID]; ok {
+		return p.checkAnswer(meta, text)
+	}
+
+	// ordinary group chatter isn't addressed to the bot
+	if meta.isGroup() {
+		return nil
+	}
+	return p.send(chatID, msgUnknownCommand)
+}
+
+func (p *Processor) answerDialog(key dialogKey, owner string, d *dialog, text string) error {
+	chatID := key.chatID
+
+	switch d.step {
+	case stepSaveName:
+		return p.finishSave(chatID, owner, d.rawQA, text)
+	case stepSaveQA:
+		// the name was given with /save already
+		if d.name != "" {
+			return p.finishSave(chatID, owner, text, d.name)
+		}
 		// store the QA, move to next step
-		p.pendingSaveName[chatID] = &saveState{rawQA: text}
-		delete(p.pendingSaveQA, chatID)
-		return p.tg.SendMessage(chatID, msgSaveName)
-	}
-	if p.pendingDelete[chatID] {
-		delete(p.pendingDelete, chatID)
-		return p.handleDeleteContent(chatID, username, text)
-	}
-	if p.pendingGet[chatID] {
-		delete(p.pendingGet, chatID)
-		return p.handleGet(chatID, username, text)
-	}
-
-	// parts := strings.SplitN(text, " ", 3)
-	switch text {
-	case DeleteCmd:
-		p.pendingDelete[chatID] = true
-		return p.tg.SendMessage(chatID, msgDeleteResponse)
-
-	case SaveCmd:
-		p.pendingSaveQA[chatID] = &saveState{}
-		return p.tg.SendMessage(chatID, msgSaveCmdResponse)
-
-	case GetCmd:
-		p.pendingGet[chatID] = true
-		return p.tg.SendMessage(chatID, msgGetCmdResponse)
-	case NextCmd:
-		return p.advanceSession(chatID)
-
-	case ListCmd:
-		return p.listItems(chatID, username)
-	case HelpCmd:
-		return p.sendHelp(chatID)
-	case StartCmd:
-		return p.sendHello(chatID)
+		return p.askFormatted(key, &dialog{step: stepSaveName, rawQA: text}, telegram.ModeHTML, msgSaveName)
+	case stepDelete:
+		return p.handleDeleteContent(chatID, owner, text)
+	case stepGet:
+		return p.handleGet(chatID, owner, text)
+	case stepSettings:
+		return p.handleSettings(chatID, owner, text)
+	case stepAdd:
+		return p.changeCards(chatID, owner, d.name, text, false)
+	case stepEdit:
+		return p.changeCards(chatID, owner, d.name, text, true)
+	case stepAccept:
+		return p.acceptCards(chatID, owner, d.rawQA, text)
+	case stepAttach:
+		// still no card for the file
+		return p.ask(key, d, msgMediaWithoutCard)
 	default:
-		return p.tg.SendMessage(chatID, msgUnknownCommand)
+		return p.send(chatID, msgUnknownCommand)
+	}
+}
+
+func (p *Processor) cmdCancel(chatID int, _ string, cmd command) error {
+	_, hadDialog := p.takePending(cmd.dialogKey())
+	_, hadSession := p.sessions[chatID]
+	delete(p.sessions, chatID)
+
+	if !hadDialog && !hadSession {
+		return p.send(chatID, msgNothingToCancel)
+	}
+	return p.send(chatID, msgCancelled)
+}
+
+func (p *Processor) cmdSave(chatID int, user string, cmd command) error {
+	name, cards := nameAndCards(cmd.rawArgs)
+
+	switch {
+	case name != "" && strings.TrimSpace(cards) != "":
+		return p.saveItem(chatID, user, name, cards)
+	case name != "":
+		return p.ask(cmd.dialogKey(), &dialog{step: stepSaveQA, name: name}, msgSaveCmdResponse)
+	case strings.TrimSpace(cards) != "":
+		return p.askFormatted(cmd.dialogKey(), &dialog{step: stepSaveName, rawQA: cards}, telegram.ModeHTML, msgSaveName)
+	default:
+		return p.ask(cmd.dialogKey(), &dialog{step: stepSaveQA}, msgSaveCmdResponse)
+	}
+}
+
+// nameAndCards splits "<name>\n<cards>", where both parts are optional
+func nameAndCards(rawArgs string) (name, cards string) {
+	name, cards, _ = strings.Cut(rawArgs, "\n")
+	name = strings.TrimSpace(name)
+	if hasPrefixFold(name, "q:") || hasPrefixFold(name, directionPrefix) {
+		// the first line already belongs to the cards
+		name, cards = "", rawArgs
+	}
+	return strings.Trim(name, `"“”`), cards
+}
+
+func (p *Processor) cmdGet(chatID int, user string, cmd command) error {
+	if len(cmd.args) > 0 {
+		return p.handleGet(chatID, user, cmd.rawArgs)
 	}
+	return p.ask(cmd.dialogKey(), &dialog{step: stepGet}, msgGetCmdResponse)
+}
+
+func (p *Processor) cmdDelete(chatID int, user string, cmd command) error {
+	if len(cmd.args) > 0 {
+		return p.handleDeleteContent(chatID, user, strings.Join(cmd.args, " "))
+	}
+	return p.ask(cmd.dialogKey(), &dialog{step: stepDelete}, msgDeleteResponse)
+}
+
+func (p *Processor) cmdSettings(chatID int, user string, cmd command) error {
+	if len(cmd.args) > 0 {
+		return p.handleSettings(chatID, user, strings.Join(cmd.args, " "))
+	}
+	return p.ask(cmd.dialogKey(), &dialog{step: stepSettings}, msgSettingsCmdResponse)
 }
 
 func (p *Processor) finishSave(chatID int, user, rawQA, name string) error {
@@ -79,23 +204,57 @@ func (p *Processor) finishSave(chatID int, user, rawQA, name string) error {
 	// 1) validate and parse rawQA
 
 	if rawQA == "" {
-		return p.tg.SendMessage(chatID, msgInvalidFormat)
+		return p.send(chatID, msgInvalidFormat)
 	}
 
 	// 2) now call your existing saveItem logic:
 	return p.saveItem(chatID, user, name, rawQA)
 }
 
-func (p *Processor) handleGet(chatID int, user, name string) error {
-	item := &storage.Item{UserName: user, Name: name}
-	exists, err := p.storage.IsExists(context.Background(), item)
+func (p *Processor) handleGet(chatID int, user, text string) error {
+	args, err := splitArgs(text)
 	if err != nil {
-		return e.Wrap("get item", err)
+		return p.send(chatID, msgBadArguments)
 	}
-	if !exists {
-		return p.tg.SendMessage(chatID, msgNoSavedItems) // or a new msgNoSuchItem
+	name, opts, err := parseSessionArgs(args, func(name string) bool {
+		_, err := p.deck(context.Background(), user, name)
+		return err == nil || errors.Is(err, storage.ErrNoShare)
+	})
+	if err != nil || name == "" {
+		return p.send(chatID, msgUsageGet)
+	}
+
+	return p.startSession(chatID, user, name, opts)
+}
+
+func (p *Processor) handleSettings(chatID int, user, text string) (err error) {
+	defer func() { err = e.WrapIfErr("change settings", err) }()
+
+	// the last word is the direction, everything before it is the deck name
+	i := strings.LastIndex(text, " ")
+	if i < 0 {
+		return p.send(chatID, msgUsageSettings)
+	}
+	name := strings.TrimSpace(text[:i])
+	dir, err := storage.ParseDirection(text[i+1:])
+	if err != nil {
+		return p.send(chatID, msgUsageSettings)
+	}
+
+	item, err := p.storage.Get(context.Background(), user, name)
+	if err != nil {
+		if errors.Is(err, storage.ErrNoSavedItems) {
+			return p.send(chatID, msgNoSavedItems)
+		}
+		return err
+	}
+
+	item.Direction = dir
+	if err := p.storage.Update(context.Background(), item); err != nil {
+		return err
 	}
-	return p.startSession(chatID, user, name)
+
+	return p.send(chatID, msgSettingsChanged, name, dir)
 }
 
 func (p *Processor) handleDeleteContent(chatID int, user, name string) error {
@@ -106,7 +265,7 @@ func (p *Processor) handleDeleteContent(chatID int, user, name string) error {
 		return e.Wrap("delete item", err)
 	}
 	if !exists {
-		return p.tg.SendMessage(chatID, msgNoSavedItems) // or a new msgNoSuchItem
+		return p.unsubscribe(chatID, user, name)
 	}
 
 	// 2) Delete
@@ -115,100 +274,261 @@ func (p *Processor) handleDeleteContent(chatID int, user, name string) error {
 	}
 
 	// 3) Confirm
-	return p.tg.SendMessage(chatID, fmt.Sprintf("Deleted deck “%s”.", name))
+	return p.send(chatID, msgDeleted, name)
 }
 
 func (p *Processor) saveItem(chatID int, user, name, content string) (err error) {
 	defer func() { err = e.WrapIfErr("save item", err) }()
 
-	// 1) Verify flashcard format
-	qaMap := extractQA(content)
-	if len(qaMap) == 0 {
-		return p.tg.SendMessage(chatID, msgInvalidFormat)
+	// 1) Pick up an optional direction line
+	content, dir, err := extractDirection(content)
+	if err != nil {
+		return p.send(chatID, msgUsageSettings)
+	}
+
+	// 2) Verify flashcard format
+	if len(extractQA(content)) == 0 {
+		return p.send(chatID, msgInvalidFormat)
 	}
 
-	// 2) Prepare item
+	// 3) Prepare item
 	item := &storage.Item{
-		Name:     name,
-		Content:  content,
-		UserName: user,
+		Name:      name,
+		Content:   content,
+		UserName:  user,
+		Direction: dir,
 	}
 
-	// 3) Check for duplicates
-	exists, err := p.storage.IsExists(context.Background(), item)
+	// 4) Check for duplicates, subscriptions included
+	exists, err := p.nameTaken(context.Background(), user, name)
 	if err != nil {
 		return err
 	}
 	if exists {
-		return p.tg.SendMessage(chatID, msgAlreadyExists)
+		return p.send(chatID, msgAlreadyExists)
 	}
 
-	// 4) Save to storage
+	// 5) Save to storage
 	if err := p.storage.Save(context.Background(), item); err != nil {
 		return err
 	}
 
-	// 5) Acknowledge
-	return p.tg.SendMessage(chatID, msgSaved)
+	// 6) Acknowledge
+	return p.send(chatID, msgSaved)
 }
 
-func (p *Processor) startSession(chatID int, user, name string) (err error) {
+func (p *Processor) startSession(chatID int, user, name string, opts sessionOptions) (err error) {
 	defer func() { err = e.WrapIfErr("start session", err) }()
 
-	item, err := p.storage.Get(context.Background(), user, name)
+	item, err := p.deck(context.Background(), user, name)
 	if err != nil {
 		if errors.Is(err, storage.ErrNoSavedItems) {
-			return p.tg.SendMessage(chatID, msgNoSavedItems)
+			return p.send(chatID, msgNoSavedItems)
+		}
+		if errors.Is(err, storage.ErrNoShare) {
+			return p.send(chatID, msgShareRevoked, name, name)
 		}
 		return err
 	}
 
-	// parse all Q&A pairs
-	qaMap := extractQA(item.Content)
-	if len(qaMap) == 0 {
-		return p.tg.SendMessage(chatID, msgInvalidFormat)
+	// parse all Q&A pairs in the order they were written
+	pairs := extractQA(item.Content)
+	if len(pairs) == 0 {
+		return p.send(chatID, msgInvalidFormat)
+	}
+	pairs = applyDirection(pairs, item.Direction)
+
+	// keep only the cards answered wrong last time
+	if opts.onlyWrong {
+		wrong, err := p.storage.WrongCards(context.Background(), user, name)
+		if err != nil {
+			return err
+		}
+		pairs = onlyCards(pairs, wrong)
+		if len(pairs) == 0 {
+			return p.send(chatID, msgNoWrongCards)
+		}
 	}
 
-	// build slice in deterministic order
-	pairs := make([]qaPair, 0, len(qaMap))
-	for q, a := range qaMap {
-		pairs = append(pairs, qaPair{Q: q, A: a})
+	// keep only the cards whose rest is over
+	if opts.onlyDue {
+		reviews, err := p.storage.Reviews(context.Background(), user, time.Time{})
+		if err != nil {
+			return err
+		}
+		pairs = dueCards(pairs, histories(reviews, name), time.Now())
+		if len(pairs) == 0 {
+			return p.send(chatID, msgNoDueCards)
+		}
+	}
+
+	if opts.order == orderShuffle {
+		if !opts.hasSeed {
+			opts.seed = rand.Int63()
+		}
+		shuffle(pairs, opts.seed)
+		if err := p.send(chatID, msgShuffled, opts.seed); err != nil {
+			return err
+		}
+	}
+
+	if opts.limit > 0 && opts.limit < len(pairs) {
+		pairs = pairs[:opts.limit]
 	}
 
 	// save session: start at idx=0
-	p.sessions[chatID] = &session{pairs: pairs, idx: 0}
+	p.sessions[chatID] = &session{
+		user:  user,
+		deck:  name,
+		pairs: pairs,
+		idx:   0,
+		group: isGroupOwner(user),
+	}
 
 	// send first question
-	return p.tg.SendMessage(chatID, pairs[0].Q)
+	return p.sendCard(chatID, cardHTML(pairs[0].Q), pairs[0].QMedia)
 }
 
 func (p *Processor) advanceSession(chatID int) error {
 	sess, ok := p.sessions[chatID]
 	if !ok {
-		return p.tg.SendMessage(chatID, msgNoActive)
+		return p.send(chatID, msgNoActive)
 	}
 
 	// send the answer to the previous question
 	prev := sess.idx
 	if prev < len(sess.pairs) {
-		if err := p.tg.SendMessage(chatID, sess.pairs[prev].A); err != nil {
+		if err := p.sendCard(chatID, cardHTML(sess.pairs[prev].A), sess.pairs[prev].AMedia); err != nil {
 			return err
 		}
 	}
 
-	// move to next
+	return p.nextCard(chatID, sess)
+}
+
+// checkAnswer grades a typed answer to the current question and moves on
+func (p *Processor) checkAnswer(from Meta, answer string) (err error) {
+	defer func() { err = e.WrapIfErr("check answer", err) }()
+
+	chatID := from.ChatID
+	sess := p.sessions[chatID]
+	card := sess.pairs[sess.idx]
+	correct := sameAnswer(answer, cardPlain(card.A))
+
+	if sess.group {
+		return p.checkGroupAnswer(from, sess, card, correct)
+	}
+
+	if correct {
+		err = p.send(chatID, msgCorrect)
+	} else {
+		err = p.sendCard(chatID, p.text(msgWrong, cardHTML(card.A)), card.AMedia)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := p.nextCard(chatID, sess); err != nil {
+		return err
+	}
+
+	// recorded last, so an answer retried after a failure counts once
+	review := &storage.Review{
+		UserName: sess.user,
+		Name:     sess.deck,
+		Card:     card.Q,
+		Correct:  correct,
+		At:       time.Now(),
+	}
+	return p.storage.AddReview(context.Background(), review)
+}
+
+// nextCard moves the session forward and asks the next question
+func (p *Processor) nextCard(chatID int, sess *session) error {
 	sess.idx++
 	if sess.idx >= len(sess.pairs) {
 		delete(p.sessions, chatID)
-		return p.tg.SendMessage(chatID, msgQuizComplete)
+		return p.send(chatID, msgQuizComplete)
 	}
 
 	// send next question
-	return p.tg.SendMessage(chatID, sess.pairs[sess.idx].Q)
+	card := sess.pairs[sess.idx]
+	return p.sendCard(chatID, cardHTML(card.Q), card.QMedia)
+}
+
+// sameAnswer compares answers ignoring case, spacing and trailing punctuation
+func sameAnswer(got, want string) bool {
+	normalize := func(s string) string {
+		s = strings.ToLower(strings.Join(strings.Fields(s), " "))
+		return strings.TrimRight(s, ".!?")
+	}
+	return normalize(got) == normalize(want)
+}
+
+// onlyCards keeps the pairs whose question is in cards
+func onlyCards(pairs []qaPair, cards []string) []qaPair {
+	keep := make(map[string]bool, len(cards))
+	for _, c := range cards {
+		keep[c] = true
+	}
+
+	res := make([]qaPair, 0, len(cards))
+	for _, p := range pairs {
+		if keep[p.Q] {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+// shuffle reorders pairs deterministically for a given seed
+func shuffle(pairs []qaPair, seed int64) {
+	r := rand.New(rand.NewSource(seed))
+	r.Shuffle(len(pairs), func(i, j int) {
+		pairs[i], pairs[j] = pairs[j], pairs[i]
+	})
+}
+
+// applyDirection turns the forward pairs into the list of cards to ask
+func applyDirection(pairs []qaPair, dir storage.Direction) []qaPair {
+	reversed := make([]qaPair, 0, len(pairs))
+	for _, p := range pairs {
+		reversed = append(reversed, qaPair{Q: p.A, A: p.Q, QMedia: p.AMedia, AMedia: p.QMedia})
+	}
+
+	switch dir {
+	case storage.DirectionReverse:
+		return reversed
+	case storage.DirectionBoth:
+		return append(pairs, reversed...)
+	default:
+		return pairs
+	}
+}
+
+// extractDirection removes a "direction: <forward|reverse|both>" line from
+// the Q&A text and returns the remaining text with the parsed direction.
+func extractDirection(text string) (string, storage.Direction, error) {
+	dir := storage.DirectionForward
+	lines := strings.Split(text, "\n")
+	kept := make([]string, 0, len(lines))
+	for _, raw := range lines {
+		line := strings.TrimSpace(raw)
+		if !strings.HasPrefix(strings.ToLower(line), directionPrefix) {
+			kept = append(kept, raw)
+			continue
+		}
+		d, err := storage.ParseDirection(line[len(directionPrefix):])
+		if err != nil {
+			return "", "", err
+		}
+		dir = d
+	}
+	return strings.Join(kept, "\n"), dir, nil
 }
 
-func extractQA(text string) map[string]string {
-	result := make(map[string]string)
+func extractQA(text string) []qaPair {
+	var result []qaPair
 
 	// 1) Drop the first line if it’s a "/save" command
 	lines := strings.Split(text, "\n")
@@ -217,37 +537,60 @@ func extractQA(text string) map[string]string {
 	}
 
 	// 2) Walk the rest of the lines, pairing q: → a:
-	var currentQ string
+	var (
+		currentQ      string
+		currentQMedia media
+	)
 	for _, raw := range lines {
 		line := strings.TrimSpace(raw)
-		if strings.HasPrefix(line, "q:") || strings.HasPrefix(line, "Q:") {
-			currentQ = strings.TrimSpace(strings.TrimPrefix(line, "q:"))
-		} else if strings.HasPrefix(line, "a:") && currentQ != "" || strings.HasPrefix(line, "A:") && currentQ != "" {
-			answer := strings.TrimSpace(strings.TrimPrefix(line, "a:"))
-			result[currentQ] = answer
-			currentQ = "" // reset until next question
+		if kind, question, id, ok := parseMediaLine(line); ok {
+			switch {
+			case question && currentQ != "":
+				currentQMedia.set(kind, id)
+			case !question && currentQ == "" && len(result) > 0:
+				// belongs to the answer just read
+				result[len(result)-1].AMedia.set(kind, id)
+			}
+			continue
+		}
+
+		if hasPrefixFold(line, "q:") {
+			currentQ = strings.TrimSpace(line[len("q:"):])
+			currentQMedia = media{}
+		} else if hasPrefixFold(line, "a:") && currentQ != "" {
+			answer := strings.TrimSpace(line[len("a:"):])
+			result = append(result, qaPair{Q: currentQ, A: answer, QMedia: currentQMedia})
+			currentQ, currentQMedia = "", media{} // reset until next question
 		}
 	}
 
 	return result
 }
 
-func (p *Processor) listItems(chatID int, user string) (err error) {
-	defer func() { err = e.WrapIfErr("list items", err) }()
-	names, err := p.storage.List(context.Background(), user)
-	if err != nil {
-		return err
-	}
-	if len(names) == 0 {
-		return p.tg.SendMessage(chatID, msgNoSavedItems)
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+func (p *Processor) cmdNext(chatID int, _ string, _ command) error {
+	return p.advanceSession(chatID)
+}
+
+func (p *Processor) cmdHelp(chatID int, _ string, cmd command) error {
+	return p.sendHelp(chatID, scopeOf(cmd.from))
+}
+
+func (p *Processor) cmdStart(chatID int, _ string, cmd command) error {
+	// "/start <code>" comes from a t.me/<bot>?start=<code> deep link
+	if len(cmd.args) > 0 {
+		return p.handleStartPayload(chatID, cmd.args[0])
 	}
-	return p.tg.SendMessage(chatID, "Your items:\n"+strings.Join(names, "\n"))
+	return p.sendHello(chatID)
 }
 
-func (p *Processor) sendHelp(chatID int) error {
-	return p.tg.SendMessage(chatID, msgHelp)
+func (p *Processor) sendHelp(chatID int, scope chatScope) error {
+	return p.tg.SendMessage(chatID, p.helpText(p.registry(), scope))
 }
 
 func (p *Processor) sendHello(chatID int) error {
-	return p.tg.SendMessage(chatID, msgHello)
+	return p.send(chatID, msgHello)
 }
@@ -0,0 +1,92 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"flashcard/clients/telegram"
+	"flashcard/events"
+	"flashcard/lib/e"
+	"flashcard/storage"
+)
+
+// classify marks errors that won't go away if the event is processed again
+func classify(err error) error {
+	var apiErr *telegram.APIError
+	switch {
+	case errors.As(err, &apiErr) && apiErr.Permanent(),
+		errors.Is(err, ErrUnknownEventType),
+		errors.Is(err, ErrUnknownMetaType):
+		return events.Permanent(err)
+	default:
+		return err
+	}
+}
+
+// DeadLetter keeps an update that failed for good and marks it handled,
+// so a restart doesn't fetch it again
+func (p *Processor) DeadLetter(event events.Event, attempts int, reason error) (err error) {
+	defer func() { err = e.WrapIfErr("can't keep dead letter", err) }()
+
+	ctx := context.Background()
+
+	dl := &storage.DeadLetter{
+		UpdateID: event.ID,
+		Raw:      event.Raw,
+		Reason:   reason.Error(),
+		Attempts: attempts,
+		FailedAt: time.Now(),
+	}
+	if err := p.storage.AddDeadLetter(ctx, dl); err != nil {
+		return err
+	}
+
+	return p.storage.MarkUpdateHandled(ctx, event.ID)
+}
+
+// Replay processes a dead letter again. It is dropped on success and
+// keeps the new error otherwise.
+func (p *Processor) Replay(updateID int) (err error) {
+	defer func() { err = e.WrapIfErr("can't replay update", err) }()
+
+	ctx := context.Background()
+
+	dl, err := p.storage.DeadLetter(ctx, updateID)
+	if err != nil {
+		return err
+	}
+
+	var upd telegram.Update
+	if err := json.Unmarshal(dl.Raw, &upd); err != nil {
+		return err
+	}
+
+	// the update is already marked handled, so skip the check in Process
+	if err := p.process(event(upd)); err != nil {
+		dl.Reason = err.Error()
+		dl.Attempts++
+		dl.FailedAt = time.Now()
+		if addErr := p.storage.AddDeadLetter(ctx, dl); addErr != nil {
+			return addErr
+		}
+		return err
+	}
+
+	return p.storage.RemoveDeadLetter(ctx, updateID)
+}
+
+// ReportFailure tells the sender of an event that it couldn't be handled,
+// in case processing broke off before any answer
+func (p *Processor) ReportFailure(event events.Event) {
+	m, err := meta(event)
+	if err != nil || m.ChatID == 0 {
+		return
+	}
+
+	text := p.catalog.Text(p.language(m), msgInternalError)
+	if err := p.tg.SendMessage(m.ChatID, text); err != nil {
+		p.logger.Error("can't report failure", "error", err)
+	}
+}
@@ -0,0 +1,131 @@
+package telegram
+
+import (
+	"log/slog"
+	"time"
+
+	"flashcard/clients/telegram"
+	"flashcard/events"
+)
+
+// dialogStep is the answer a chat's pending dialog waits for
+type dialogStep int
+
+const (
+	stepSaveQA   dialogStep = iota // waiting for the Q&A
+	stepSaveName                   // waiting for the final name
+	stepDelete                     // waiting for a deck name to delete
+	stepGet                        // waiting for a deck name to quiz
+	stepSettings                   // waiting for "<name> <direction>"
+	stepAdd                        // waiting for cards to add to a deck
+	stepEdit                       // waiting for cards to replace a deck's cards
+	stepAccept                     // waiting for a deck name for generated cards
+	stepAttach                     // waiting for the card a sent file belongs to
+)
+
+// dialogKey keeps dialogs of different users in the same group apart
+type dialogKey struct {
+	chatID int
+	userID int
+}
+
+// dialog is an interactive prompt waiting for the user's next message
+type dialog struct {
+	step       dialogStep
+	name       string      // the deck name given with the command, if any
+	rawQA      string      // the Q&A text the user sent
+	attachment *Attachment // the file waiting for its card
+	prev       *dialog     // the dialog interrupted by the file, resumed with its card
+	updated    time.Time   // last activity, for the idle timeout
+	lang       string      // locale of the user, to tell them the dialog expired
+}
+
+// ask remembers that the user now owes an answer to d and sends the prompt,
+// the catalog message msg
+func (p *Processor) ask(key dialogKey, d *dialog, msg string, args ...any) error {
+	return p.askFormatted(key, d, telegram.ModePlain, msg, args...)
+}
+
+// askFormatted is ask with a prompt marked up for mode
+func (p *Processor) askFormatted(key dialogKey, d *dialog, mode telegram.ParseMode, msg string, args ...any) error {
+	d.updated = time.Now()
+	d.lang = p.lang
+	p.pending[key] = d
+	return p.tg.SendFormatted(key.chatID, p.text(msg, args...), mode)
+}
+
+// takePending removes and returns the user's pending dialog, if any
+func (p *Processor) takePending(key dialogKey) (*dialog, bool) {
+	d, ok := p.pending[key]
+	if ok {
+		delete(p.pending, key)
+	}
+	return d, ok
+}
+
+// expireDialogs drops dialogs idle for longer than the timeout and tells the users
+func (p *Processor) expireDialogs() {
+	if p.dialogTimeout <= 0 {
+		return
+	}
+
+	for key, d := range p.pending {
+		if time.Since(d.updated) < p.dialogTimeout {
+			continue
+		}
+		delete(p.pending, key)
+
+		if err := p.tg.SendMessage(key.chatID, p.catalog.Text(d.lang, msgDialogExpired)); err != nil {
+			slog.Warn("can't notify about expired dialog", "chat", key.chatID, "user", key.userID, "error", err)
+		}
+	}
+}
+
+// snapshot is the in-memory state an event may change: the sender's
+// pending dialog and the chat's quiz session
+type snapshot struct {
+	key     dialogKey
+	dialog  *dialog  // a copy, nil if there was none
+	session *session // a copy, nil if there was none
+	hasMeta bool
+}
+
+func (p *Processor) snapshot(event events.Event) snapshot {
+	m, err := meta(event)
+	if err != nil {
+		return snapshot{}
+	}
+
+	s := snapshot{
+		key:     dialogKey{chatID: m.ChatID, userID: m.UserID},
+		hasMeta: true,
+	}
+	if d, ok := p.pending[s.key]; ok {
+		cp := *d
+		s.dialog = &cp
+	}
+	if sess, ok := p.sessions[m.ChatID]; ok {
+		cp := *sess
+		s.session = &cp
+	}
+	return s
+}
+
+// restore puts the dialog and the session back as they were in s
+func (p *Processor) restore(s snapshot) {
+	if !s.hasMeta {
+		return
+	}
+
+	if s.dialog != nil {
+		p.pending[s.key] = s.dialog
+	} else {
+		delete(p.pending, s.key)
+	}
+
+	if s.session != nil {
+		p.sessions[s.key.chatID] = s.session
+	} else {
+		delete(p.sessions, s.key.chatID)
+	}
+}
@@ -0,0 +1,73 @@
+package telegram
+
+import (
+	"context"
+	"time"
+
+	"flashcard/lib/e"
+	"flashcard/storage"
+)
+
+// cardHistory is what the scheduler needs to know about a single card
+type cardHistory struct {
+	last   time.Time // last review
+	streak int       // correct answers in a row at the end of the history
+}
+
+// interval returns how long a card rests after streak correct answers in a row:
+// a wrong answer makes it due again at once, then 1, 2, 4, 8… days.
+func interval(streak int) time.Duration {
+	if streak <= 0 {
+		return 0
+	}
+	if streak > 10 {
+		streak = 10
+	}
+	return time.Duration(1<<(streak-1)) * 24 * time.Hour
+}
+
+// histories folds a deck's reviews, oldest first, into per-card histories
+func histories(reviews []storage.Review, deck string) map[string]cardHistory {
+	res := make(map[string]cardHistory)
+	for _, r := range reviews {
+		if r.Name != deck {
+			continue
+		}
+		h := res[r.Card]
+		h.last = r.At
+		if r.Correct {
+			h.streak++
+		} else {
+			h.streak = 0
+		}
+		res[r.Card] = h
+	}
+	return res
+}
+
+// dueCards keeps the cards that were never reviewed or whose rest is over
+func dueCards(pairs []qaPair, hist map[string]cardHistory, now time.Time) []qaPair {
+	res := make([]qaPair, 0, len(pairs))
+	for _, p := range pairs {
+		h, ok := hist[p.Q]
+		if !ok || !now.Before(h.last.Add(interval(h.streak))) {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+// DueCount returns how many cards of all the user's decks are due for review.
+// It only reads storage, so it is safe to call from other goroutines.
+func (p *Processor) DueCount(ctx context.Context, user string) (n int, err error) {
+	defer func() { err = e.WrapIfErr("count due cards", err) }()
+
+	decks, err := p.deckSummaries(ctx, user)
+	if err != nil {
+		return 0, err
+	}
+	for _, d := range decks {
+		n += d.due
+	}
+	return n, nil
+}
@@ -0,0 +1,125 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"flashcard/lib/e"
+	"flashcard/storage"
+)
+
+func (p *Processor) cmdAdd(chatID int, user string, cmd command) error {
+	name, cards := nameAndCards(cmd.rawArgs)
+	switch {
+	case name == "":
+		return p.send(chatID, msgUsageAdd)
+	case len(extractQA(cards)) > 0:
+		return p.changeCards(chatID, user, name, cards, false)
+	default:
+		return p.ask(cmd.dialogKey(), &dialog{step: stepAdd, name: name}, msgSendCards)
+	}
+}
+
+func (p *Processor) cmdEdit(chatID int, user string, cmd command) error {
+	name, cards := nameAndCards(cmd.rawArgs)
+	switch {
+	case name == "":
+		return p.send(chatID, msgUsageEdit)
+	case len(extractQA(cards)) > 0:
+		return p.changeCards(chatID, user, name, cards, true)
+	default:
+		return p.ask(cmd.dialogKey(), &dialog{step: stepEdit, name: name}, msgSendCards)
+	}
+}
+
+// changeCards appends cards to a deck, or replaces all of its cards,
+// and tells the subscribers about questions they haven't seen before.
+func (p *Processor) changeCards(chatID int, user, name, cards string, replace bool) (err error) {
+	defer func() { err = e.WrapIfErr("change cards", err) }()
+	ctx := context.Background()
+
+	item, err := p.storage.Get(ctx, user, name)
+	if errors.Is(err, storage.ErrNoSavedItems) {
+		return p.send(chatID, msgNoSavedItems)
+	}
+	if err != nil {
+		return err
+	}
+
+	cards, dir, err := extractDirection(cards)
+	if err != nil {
+		return p.send(chatID, msgUsageSettings)
+	}
+	if len(extractQA(cards)) == 0 {
+		return p.send(chatID, msgInvalidFormat)
+	}
+
+	// a retry after a failed reply finds the cards already appended
+	// and must neither append them again nor notify twice
+	stored := !replace && p.retrying && strings.HasSuffix(item.Content, "\n"+cards)
+
+	old := extractQA(item.Content)
+	switch {
+	case stored:
+	case replace:
+		item.Content = cards
+		item.Direction = dir
+	default:
+		item.Content += "\n" + cards
+	}
+	if !stored {
+		if err := p.storage.Update(ctx, item); err != nil {
+			return err
+		}
+
+		added := newCards(old, extractQA(item.Content))
+		if added > 0 {
+			p.notifySubscribers(ctx, item, added)
+		}
+	}
+
+	return p.send(chatID, msgCardsChanged, name, len(extractQA(item.Content)))
+}
+
+// notifySubscribers tells everyone following the deck that cards were added.
+// A failed notification must not undo the author's edit, so errors are only logged.
+func (p *Processor) notifySubscribers(ctx context.Context, item *storage.Item, added int) {
+	if item.Visibility != storage.VisibilityShared {
+		// subscribers of an unshared deck can't open it to see the cards
+		return
+	}
+
+	subs, err := p.storage.Subscribers(ctx, item.UserName, item.Name)
+	if err != nil {
+		p.logger.Warn("can't notify subscribers", "error", err)
+		return
+	}
+
+	for _, sub := range subs {
+		if sub.ChatID == 0 {
+			continue
+		}
+		// the subscriber, not the author, reads this
+		lang := p.chatLanguage(ctx, sub.ChatID)
+		if err := p.sendIn(lang, sub.ChatID, msgCardsAdded, sub.Name, added); err != nil {
+			p.logger.Warn("can't notify subscriber", "subscriber", sub.UserName, "error", err)
+		}
+	}
+}
+
+// newCards counts the questions in now that weren't in before
+func newCards(before, now []qaPair) int {
+	seen := make(map[string]bool, len(before))
+	for _, p := range before {
+		seen[p.Q] = true
+	}
+
+	n := 0
+	for _, p := range now {
+		if !seen[p.Q] {
+			n++
+		}
+	}
+	return n
+}
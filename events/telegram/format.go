@@ -0,0 +1,116 @@
+package telegram
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"flashcard/clients/telegram"
+)
+
+// cardTags are the markers card authors may use and the HTML they become
+var cardTags = map[byte][2]string{
+	'*': {"<b>", "</b>"},
+	'_': {"<i>", "</i>"},
+	'`': {"<code>", "</code>"},
+}
+
+// cardHTML renders the *bold*, _italic_ and `code` markup of card text as
+// Telegram HTML. Everything else is escaped, so any card text is safe to send.
+func cardHTML(s string) string {
+	return renderCard(s, true)
+}
+
+// cardPlain drops the markup of card text, e.g. to compare typed answers
+func cardPlain(s string) string {
+	return renderCard(s, false)
+}
+
+func renderCard(s string, html bool) string {
+	var b strings.Builder
+
+	text := func(t string) {
+		if html {
+			t = telegram.EscapeHTML(t)
+		}
+		b.WriteString(t)
+	}
+
+	start := 0
+	for i := 0; i < len(s); i++ {
+		tags, ok := cardTags[s[i]]
+		if !ok {
+			continue
+		}
+		end := closingMarker(s, i)
+		if end < 0 {
+			continue
+		}
+
+		text(s[start:i])
+		inner := s[i+1 : end]
+		if html {
+			b.WriteString(tags[0])
+		}
+		if s[i] == '`' {
+			// no markup inside code
+			text(inner)
+		} else {
+			b.WriteString(renderCard(inner, html))
+		}
+		if html {
+			b.WriteString(tags[1])
+		}
+		i = end
+		start = end + 1
+	}
+	text(s[start:])
+
+	return b.String()
+}
+
+// closingMarker finds the marker closing the one at s[open], or -1.
+// Like in Markdown, "*" and "_" must hug the text they mark, so
+// snake_case words and "2 * 3" stay as they are.
+func closingMarker(s string, open int) int {
+	m := s[open]
+	if m != '`' {
+		if open+1 >= len(s) || isSpaceAt(s, open+1) || (open > 0 && isWordBefore(s, open)) {
+			return -1
+		}
+	}
+
+	for j := open + 2; j < len(s); j++ {
+		if s[j] != m {
+			continue
+		}
+		if m == '`' {
+			return j
+		}
+		if isSpaceBefore(s, j) || (j+1 < len(s) && isWordAt(s, j+1)) {
+			continue
+		}
+		return j
+	}
+	return -1
+}
+
+func isSpaceAt(s string, i int) bool {
+	r, _ := utf8.DecodeRuneInString(s[i:])
+	return unicode.IsSpace(r)
+}
+
+func isSpaceBefore(s string, i int) bool {
+	r, _ := utf8.DecodeLastRuneInString(s[:i])
+	return unicode.IsSpace(r)
+}
+
+func isWordAt(s string, i int) bool {
+	r, _ := utf8.DecodeRuneInString(s[i:])
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func isWordBefore(s string, i int) bool {
+	r, _ := utf8.DecodeLastRuneInString(s[:i])
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,38 @@
+package telegram
+
+import "testing"
+
+func TestRenderCard(t *testing.T) {
+	tests := []struct {
+		in    string
+		html  string
+		plain string
+	}{
+		{in: "plain", html: "plain", plain: "plain"},
+		{in: "*bold*", html: "<b>bold</b>", plain: "bold"},
+		{in: "_italic_ and `code`", html: "<i>italic</i> and <code>code</code>", plain: "italic and code"},
+		{in: "*bold _nested_*", html: "<b>bold <i>nested</i></b>", plain: "bold nested"},
+		{in: "`a*b* <c>`", html: "<code>a*b* &lt;c&gt;</code>", plain: "a*b* <c>"},
+		{in: "*жирный* и _курсив_", html: "<b>жирный</b> и <i>курсив</i>", plain: "жирный и курсив"},
+		{in: "_é_", html: "<i>é</i>", plain: "é"},
+		{in: "snake_case_word", html: "snake_case_word", plain: "snake_case_word"},
+		{in: "my_var and _x_", html: "my_var and <i>x</i>", plain: "my_var and x"},
+		{in: "2 * 3 * 4", html: "2 * 3 * 4", plain: "2 * 3 * 4"},
+		{in: "x*y*", html: "x*y*", plain: "x*y*"},
+		{in: "*unclosed", html: "*unclosed", plain: "*unclosed"},
+		{in: "`unclosed code", html: "`unclosed code", plain: "`unclosed code"},
+		{in: "**", html: "**", plain: "**"},
+		{in: "* spaced *", html: "* spaced *", plain: "* spaced *"},
+		{in: "a < b & c > d", html: "a &lt; b &amp; c &gt; d", plain: "a < b & c > d"},
+		{in: "*<b>*", html: "<b>&lt;b&gt;</b>", plain: "<b>"},
+	}
+
+	for _, tt := range tests {
+		if got := cardHTML(tt.in); got != tt.html {
+			t.Errorf("cardHTML(%q) = %q, want %q", tt.in, got, tt.html)
+		}
+		if got := cardPlain(tt.in); got != tt.plain {
+			t.Errorf("cardPlain(%q) = %q, want %q", tt.in, got, tt.plain)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"flashcard/clients/telegram"
+	"flashcard/generator"
+	"flashcard/generator/document"
+	"flashcard/lib/e"
+	"flashcard/storage"
+)
+
+const (
+	defaultGeneratedCards = 10
+	generateTimeout       = 90 * time.Second
+
+	maxDocumentSize = 10 << 20 // bytes
+	chunkSize       = 4000     // bytes of text per generator request
+	cardsPerChunk   = 5
+	maxChunks       = generator.MaxCards / cardsPerChunk
+)
+
+// MaxGenerationTime is the longest processing an event may wait for the
+// generator: a document is turned into cards one chunk at a time
+const MaxGenerationTime = maxChunks * generateTimeout
+
+// cmdGenerate asks the generator for cards about a topic and previews them.
+// "/generate <topic> [N]"; the user then names the deck to keep them.
+func (p *Processor) cmdGenerate(chatID int, _ string, cmd command) (err error) {
+	defer func() { err = e.WrapIfErr("generate cards", err) }()
+
+	if p.generator == nil {
+		return p.send(chatID, msgNoGenerator)
+	}
+
+	if cmd.from.Document != nil {
+		return p.generateFromDocument(chatID, cmd)
+	}
+
+	args := cmd.args
+	n := defaultGeneratedCards
+	if len(args) > 1 {
+		if v, err := strconv.Atoi(args[len(args)-1]); err == nil {
+			if v <= 0 || v > generator.MaxCards {
+				return p.send(chatID, msgUsageGenerate, generator.MaxCards)
+			}
+			n, args = v, args[:len(args)-1]
+		}
+	}
+	topic := joinArgs(args)
+	if topic == "" {
+		return p.send(chatID, msgUsageGenerate, generator.MaxCards)
+	}
+
+	if err := p.send(chatID, msgGenerating); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), generateTimeout)
+	defer cancel()
+
+	cards, err := p.generator.Generate(ctx, generator.Request{Topic: topic, N: n})
+	if errors.Is(err, generator.ErrBadOutput) || errors.Is(err, generator.ErrNoCards) {
+		return p.send(chatID, msgGenerateFailed)
+	}
+	if err != nil {
+		return err
+	}
+
+	rawQA := formatQA(cards)
+	return p.ask(cmd.dialogKey(), &dialog{step: stepAccept, rawQA: rawQA}, msgGeneratedPreview, len(cards), rawQA)
+}
+
+// generateFromDocument makes cards from an uploaded text, Markdown or PDF file.
+// "/generate [N]" as the caption limits the number of cards.
+func (p *Processor) generateFromDocument(chatID int, cmd command) (err error) {
+	defer func() { err = e.WrapIfErr("generate cards from document", err) }()
+
+	limit := generator.MaxCards
+	if len(cmd.args) > 0 {
+		v, err := strconv.Atoi(cmd.args[0])
+		if err != nil || v <= 0 || v > generator.MaxCards {
+			return p.send(chatID, msgUsageGenerate, generator.MaxCards)
+		}
+		limit = v
+	}
+
+	doc := cmd.from.Document
+	if doc.FileSize > maxDocumentSize {
+		return p.send(chatID, msgDocumentTooBig)
+	}
+	data, err := p.tg.DownloadFile(doc.FileID, maxDocumentSize)
+	if errors.Is(err, telegram.ErrFileTooBig) {
+		return p.send(chatID, msgDocumentTooBig)
+	}
+	if err != nil {
+		return err
+	}
+
+	text, err := document.Extract(doc.FileName, doc.MimeType, data)
+	if errors.Is(err, document.ErrUnsupported) || errors.Is(err, document.ErrNoText) {
+		return p.send(chatID, msgUnreadableDocument)
+	}
+	if err != nil {
+		return err
+	}
+
+	chunks := document.Chunk(text, chunkSize)
+	if len(chunks) > maxChunks {
+		if err := p.send(chatID, msgDocumentTruncated, maxChunks, len(chunks)); err != nil {
+			return err
+		}
+		chunks = chunks[:maxChunks]
+	}
+	if err := p.send(chatID, msgGenerating); err != nil {
+		return err
+	}
+
+	lists := make([][]generator.Card, 0, len(chunks))
+	for _, chunk := range chunks {
+		cards, err := p.generateChunk(chunk)
+		// one bad answer from the model shouldn't waste the other chunks
+		if errors.Is(err, generator.ErrBadOutput) || errors.Is(err, generator.ErrNoCards) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		lists = append(lists, cards)
+	}
+
+	cards := generator.Merge(lists...)
+	if len(cards) == 0 {
+		return p.send(chatID, msgGenerateFailed)
+	}
+	if len(cards) > limit {
+		cards = cards[:limit]
+	}
+
+	rawQA := formatQA(cards)
+	return p.ask(cmd.dialogKey(), &dialog{step: stepAccept, rawQA: rawQA}, msgGeneratedPreview, len(cards), rawQA)
+}
+
+func (p *Processor) generateChunk(text string) ([]generator.Card, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), generateTimeout)
+	defer cancel()
+
+	return p.generator.Generate(ctx, generator.Request{Text: text, N: cardsPerChunk})
+}
+
+// acceptCards keeps previewed cards: a new deck, or more cards for an existing one
+func (p *Processor) acceptCards(chatID int, user, rawQA, name string) error {
+	name = strings.TrimSpace(name)
+
+	_, err := p.storage.Get(context.Background(), user, name)
+	switch {
+	case err == nil:
+		return p.changeCards(chatID, user, name, rawQA, false)
+	case errors.Is(err, storage.ErrNoSavedItems):
+		return p.saveItem(chatID, user, name, rawQA)
+	default:
+		return e.Wrap("accept cards", err)
+	}
+}
+
+// formatQA writes cards in the q:/a: format decks are saved in
+func formatQA(cards []generator.Card) string {
+	var b strings.Builder
+	for _, c := range cards {
+		fmt.Fprintf(&b, "q:%s\na:%s\n", c.Question, c.Answer)
+	}
+	return b.String()
+}
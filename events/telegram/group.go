@@ -0,0 +1,62 @@
+package telegram
+
+import (
+	"context"
+	"strings"
+
+	"flashcard/clients/telegram"
+	"flashcard/lib/e"
+)
+
+// leaderboardSize is how many players /leaderboard shows
+const leaderboardSize = 10
+
+// isAdmin reports whether the user may manage the decks of a group
+func (p *Processor) isAdmin(chatID, userID int) (bool, error) {
+	member, err := p.tg.ChatMember(chatID, userID)
+	if err != nil {
+		return false, err
+	}
+	return member.Status == "creator" || member.Status == "administrator", nil
+}
+
+// checkGroupAnswer scores the first correct answer in a group quiz.
+// Wrong answers are ignored so others can keep guessing.
+func (p *Processor) checkGroupAnswer(from Meta, sess *session, card qaPair, correct bool) error {
+	if !correct {
+		return nil
+	}
+
+	if err := p.sendCard(from.ChatID, p.text(msgGroupCorrect, telegram.EscapeHTML(from.displayName()), cardHTML(card.A)), card.AMedia); err != nil {
+		return err
+	}
+	if err := p.nextCard(from.ChatID, sess); err != nil {
+		return err
+	}
+
+	// scored last, so an answer retried after a failure counts once
+	return p.storage.AddPoint(context.Background(), from.ChatID, from.UserID, from.displayName())
+}
+
+func (p *Processor) cmdLeaderboard(chatID int, _ string, cmd command) (err error) {
+	defer func() { err = e.WrapIfErr("show leaderboard", err) }()
+
+	if !cmd.from.isGroup() {
+		return p.send(chatID, msgGroupsOnly)
+	}
+
+	scores, err := p.storage.Leaderboard(context.Background(), chatID, leaderboardSize)
+	if err != nil {
+		return err
+	}
+	if len(scores) == 0 {
+		return p.send(chatID, msgNoScores)
+	}
+
+	var b strings.Builder
+	b.WriteString(p.text(msgLeaderboardHeader) + "\n")
+	for i, sc := range scores {
+		b.WriteString(p.text(msgLeaderboardLine, i+1, sc.UserName, sc.Points) + "\n")
+	}
+	return p.tg.SendMessage(chatID, b.String())
+}
@@ -0,0 +1,94 @@
+package telegram
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"flashcard/i18n"
+	"flashcard/lib/e"
+)
+
+// languageAuto resets /language to the user's Telegram setting
+const languageAuto = "auto"
+
+// text formats a catalog message in the language of the current event
+func (p *Processor) text(key string, args ...any) string {
+	return p.catalog.Text(p.lang, key, args...)
+}
+
+// send sends a catalog message in the language of the current event
+func (p *Processor) send(chatID int, key string, args ...any) error {
+	return p.tg.SendMessage(chatID, p.text(key, args...))
+}
+
+// sendIn is send in lang rather than the sender's language, for messages
+// to other people than the sender
+func (p *Processor) sendIn(lang string, chatID int, key string, args ...any) error {
+	return p.tg.SendMessage(chatID, p.catalog.Text(lang, key, args...))
+}
+
+// language picks the locale for the sender of an event: the one chosen
+// with /language, or else the language of their Telegram app
+func (p *Processor) language(meta Meta) string {
+	lang, err := p.storage.Language(context.Background(), meta.UserID)
+	if err != nil {
+		// talking in the wrong language beats not answering
+		p.logger.Warn("can't get language", "error", err)
+	}
+	if lang != "" && p.catalog.Has(lang) {
+		return lang
+	}
+	return p.catalog.Match(meta.LanguageCode)
+}
+
+// cmdLanguage shows or changes the language of the sender:
+// "/language", "/language <code>" or "/language auto"
+func (p *Processor) cmdLanguage(chatID int, _ string, cmd command) (err error) {
+	defer func() { err = e.WrapIfErr("change language", err) }()
+	ctx := context.Background()
+
+	available := strings.Join(p.catalog.Locales(), ", ")
+	if len(cmd.args) == 0 {
+		return p.send(chatID, msgLanguageCurrent, p.text(msgLanguageName), available)
+	}
+
+	lang := strings.ToLower(cmd.args[0])
+	switch {
+	case lang == languageAuto:
+		if err := p.storage.RemoveLanguage(ctx, cmd.from.UserID); err != nil {
+			return err
+		}
+		p.lang = p.catalog.Match(cmd.from.LanguageCode)
+		return p.send(chatID, msgLanguageAuto)
+	case !p.catalog.Has(lang):
+		return p.send(chatID, msgUnknownLanguage, available)
+	}
+
+	if err := p.storage.SetLanguage(ctx, cmd.from.UserID, lang); err != nil {
+		return err
+	}
+	// answer in the new language already
+	p.lang = lang
+	return p.send(chatID, msgLanguageSet)
+}
+
+// ReminderText words a due-cards reminder for a chat.
+// It only reads storage, so it is safe to call from other goroutines.
+func (p *Processor) ReminderText(ctx context.Context, chatID, due int) string {
+	return p.catalog.Text(p.chatLanguage(ctx, chatID), msgReminder, due)
+}
+
+// chatLanguage picks the locale for a message nobody in the chat asked for
+// right now. In private chats the chat is the user, so their language is
+// used; groups get the fallback.
+func (p *Processor) chatLanguage(ctx context.Context, chatID int) string {
+	lang, err := p.storage.Language(ctx, chatID)
+	if err != nil {
+		slog.Warn("can't get language", "chat", chatID, "error", err)
+	}
+	if lang == "" || !p.catalog.Has(lang) {
+		return i18n.Fallback
+	}
+	return lang
+}
@@ -0,0 +1,177 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"flashcard/clients/telegram"
+	"flashcard/events"
+	"flashcard/lib/e"
+	"flashcard/storage"
+)
+
+const (
+	listPageSize = 10 // decks per /list page
+
+	listCallback = "list:" // button data "list:<page>"
+)
+
+// deckSummary is a line of /list
+type deckSummary struct {
+	name        string
+	subscribed  bool
+	cards       int
+	due         int
+	lastStudied time.Time // zero if never studied
+}
+
+func (p *Processor) cmdList(chatID int, user string, _ command) error {
+	return p.showList(chatID, user, 0, 0)
+}
+
+// processCallback handles a press of one of the bot's inline buttons
+func (p *Processor) processCallback(event events.Event) (err error) {
+	defer func() { err = e.WrapIfErr("can't process callback", err) }()
+
+	meta, err := meta(event)
+	if err != nil {
+		return err
+	}
+
+	p.lang = p.language(meta)
+	if err := p.claimOwner(meta); err != nil {
+		return err
+	}
+
+	// stop the button's spinner whatever happens next
+	if err := p.tg.AnswerCallback(meta.CallbackID, ""); err != nil {
+		return err
+	}
+
+	if page, ok := strings.CutPrefix(event.Text, listCallback); ok {
+		n, err := strconv.Atoi(page)
+		if err != nil {
+			return nil
+		}
+		return p.showList(meta.ChatID, meta.owner(), n, meta.MessageID)
+	}
+	return nil
+}
+
+// showList sends a page of the user's decks, or turns the list message
+// with the given id to that page
+func (p *Processor) showList(chatID int, user string, page, messageID int) (err error) {
+	defer func() { err = e.WrapIfErr("list items", err) }()
+
+	decks, err := p.deckSummaries(context.Background(), user)
+	if err != nil {
+		return err
+	}
+	if len(decks) == 0 {
+		return p.send(chatID, msgNoSavedItems)
+	}
+
+	text, kb := p.listPage(decks, page, time.Now())
+	if messageID != 0 {
+		return p.tg.EditMessage(chatID, messageID, text, telegram.ModePlain, kb)
+	}
+	return p.tg.SendKeyboard(chatID, text, telegram.ModePlain, kb)
+}
+
+// deckSummaries describes the user's own decks, then the subscribed ones
+func (p *Processor) deckSummaries(ctx context.Context, user string) ([]deckSummary, error) {
+	own, subscribed, err := p.deckNames(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(own)
+	sort.Strings(subscribed)
+
+	reviews, err := p.storage.Reviews(ctx, user, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	res := make([]deckSummary, 0, len(own)+len(subscribed))
+	for i, name := range append(own, subscribed...) {
+		item, err := p.deck(ctx, user, name)
+		if errors.Is(err, storage.ErrNoShare) {
+			// listed without cards, so it can still be unsubscribed
+			res = append(res, deckSummary{name: name, subscribed: true})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		pairs := applyDirection(extractQA(item.Content), item.Direction)
+		hist := histories(reviews, name)
+
+		d := deckSummary{
+			name:       name,
+			subscribed: i >= len(own),
+			cards:      len(pairs),
+			due:        len(dueCards(pairs, hist, now)),
+		}
+		for _, h := range hist {
+			if h.last.After(d.lastStudied) {
+				d.lastStudied = h.last
+			}
+		}
+		res = append(res, d)
+	}
+	return res, nil
+}
+
+// listPage renders one page of decks with buttons to the neighbouring pages
+func (p *Processor) listPage(decks []deckSummary, page int, now time.Time) (string, *telegram.InlineKeyboardMarkup) {
+	pages := (len(decks) + listPageSize - 1) / listPageSize
+	page = max(0, min(page, pages-1))
+
+	var b strings.Builder
+	b.WriteString(p.text(msgListHeader, page+1, pages))
+	b.WriteString("\n")
+	for _, d := range decks[page*listPageSize : min(len(decks), (page+1)*listPageSize)] {
+		b.WriteString("\n" + p.deckLine(d, now))
+	}
+
+	var buttons []telegram.InlineKeyboardButton
+	if page > 0 {
+		buttons = append(buttons, telegram.InlineKeyboardButton{
+			Text:         p.text(msgPrevPage),
+			CallbackData: listCallback + strconv.Itoa(page-1),
+		})
+	}
+	if page < pages-1 {
+		buttons = append(buttons, telegram.InlineKeyboardButton{
+			Text:         p.text(msgNextPage),
+			CallbackData: listCallback + strconv.Itoa(page+1),
+		})
+	}
+	if len(buttons) == 0 {
+		return b.String(), nil
+	}
+	return b.String(), &telegram.InlineKeyboardMarkup{InlineKeyboard: [][]telegram.InlineKeyboardButton{buttons}}
+}
+
+func (p *Processor) deckLine(d deckSummary, now time.Time) string {
+	studied := p.text(msgNeverStudied)
+	if !d.lastStudied.IsZero() {
+		switch daysBetween(day(d.lastStudied), day(now)) {
+		case 0:
+			studied = p.text(msgStudiedToday)
+		default:
+			studied = p.text(msgLastStudied, d.lastStudied.Local().Format(p.text(msgDateLayout)))
+		}
+	}
+
+	name := d.name
+	if d.subscribed {
+		name += p.text(msgSubscribedMark)
+	}
+	return p.text(msgListLine, name, d.cards, d.due, studied)
+}
@@ -0,0 +1,254 @@
+package telegram
+
+import (
+	"strings"
+
+	"flashcard/clients/telegram"
+)
+
+// maxMediaSize is the largest file a local copy is kept of
+const maxMediaSize = 10 << 20 // bytes
+
+// AttachKind is the type of file attached to a message
+type AttachKind int
+
+const (
+	AttachPhoto AttachKind = iota
+	AttachVoice
+	AttachAudio
+)
+
+var attachKinds = []AttachKind{AttachPhoto, AttachVoice, AttachAudio}
+
+// Attachment is a photo or a recording sent along with a message
+type Attachment struct {
+	Kind   AttachKind
+	FileID string
+	Size   int
+}
+
+// media are the files shown with one side of a card, by Telegram file_id
+type media struct {
+	image string
+	voice string
+	audio string
+}
+
+// sidePrefixes start an "image: answer" line, which puts the file on the answer
+var sidePrefixes = []string{"image:", "voice:", "audio:"}
+
+// lineName is how the kind is written in saved cards: "qimg:", "avoice:", …
+func (k AttachKind) lineName() string {
+	switch k {
+	case AttachVoice:
+		return "voice"
+	case AttachAudio:
+		return "audio"
+	default:
+		return "img"
+	}
+}
+
+// linePrefix is the line holding a file of kind k for the question or the answer
+func (k AttachKind) linePrefix(question bool) string {
+	if question {
+		return "q" + k.lineName() + ":"
+	}
+	return "a" + k.lineName() + ":"
+}
+
+// fileExt names uploaded copies; Telegram only looks at it for the file type
+func (k AttachKind) fileExt() string {
+	switch k {
+	case AttachVoice:
+		return ".ogg"
+	case AttachAudio:
+		return ".mp3"
+	default:
+		return ".jpg"
+	}
+}
+
+func (m *media) set(kind AttachKind, fileID string) {
+	switch kind {
+	case AttachVoice:
+		m.voice = fileID
+	case AttachAudio:
+		m.audio = fileID
+	default:
+		m.image = fileID
+	}
+}
+
+// files lists the attachments in the order they are sent
+func (m media) files() []Attachment {
+	var res []Attachment
+	for _, kind := range attachKinds {
+		if id := m.get(kind); id != "" {
+			res = append(res, Attachment{Kind: kind, FileID: id})
+		}
+	}
+	return res
+}
+
+func (m media) get(kind AttachKind) string {
+	switch kind {
+	case AttachVoice:
+		return m.voice
+	case AttachAudio:
+		return m.audio
+	default:
+		return m.image
+	}
+}
+
+// parseMediaLine reads a "qimg: <file_id>"-like line of saved cards
+func parseMediaLine(line string) (kind AttachKind, question bool, fileID string, ok bool) {
+	for _, kind := range attachKinds {
+		for _, question := range []bool{true, false} {
+			if id, ok := cutPrefixFold(line, kind.linePrefix(question)); ok {
+				return kind, question, strings.TrimSpace(id), true
+			}
+		}
+	}
+	return 0, false, "", false
+}
+
+// attachMedia writes the file_id into the last card of text: after its
+// question, or after its answer if text has an "image: answer" line.
+// ok is false if text has no card to attach to.
+func attachMedia(text string, att Attachment) (res string, ok bool) {
+	lines := strings.Split(text, "\n")
+
+	question := true
+	kept := make([]string, 0, len(lines)+1)
+	for _, raw := range lines {
+		side, isSide := cutSidePrefix(strings.TrimSpace(raw))
+		if !isSide {
+			kept = append(kept, raw)
+			continue
+		}
+		if strings.EqualFold(strings.TrimSpace(side), "answer") {
+			question = false
+		}
+	}
+
+	target := "a:"
+	if question {
+		target = "q:"
+	}
+	for i := len(kept) - 1; i >= 0; i-- {
+		if !hasPrefixFold(strings.TrimSpace(kept[i]), target) {
+			continue
+		}
+		line := att.Kind.linePrefix(question) + " " + att.FileID
+		kept = append(kept[:i+1], append([]string{line}, kept[i+1:]...)...)
+		return strings.Join(kept, "\n"), true
+	}
+	return text, false
+}
+
+func cutSidePrefix(line string) (string, bool) {
+	for _, prefix := range sidePrefixes {
+		if side, ok := cutPrefixFold(line, prefix); ok {
+			return side, true
+		}
+	}
+	return line, false
+}
+
+// keepMedia stores a local copy of a card's file, if blobs are enabled.
+// The card still works through Telegram's file_id, so failures are only logged.
+func (p *Processor) keepMedia(att Attachment) {
+	if p.blobs == nil {
+		return
+	}
+	if att.Size > maxMediaSize {
+		p.logger.Info("file is too big to keep a copy", "file", att.FileID)
+		return
+	}
+
+	data, err := p.tg.DownloadFile(att.FileID, maxMediaSize)
+	if err != nil {
+		p.logger.Warn("can't keep file", "file", att.FileID, "error", err)
+		return
+	}
+	if err := p.blobs.Save(att.FileID, data); err != nil {
+		p.logger.Warn("can't keep file", "file", att.FileID, "error", err)
+	}
+}
+
+// sendCard sends one side of a card. The text, already in Telegram HTML,
+// becomes the caption of the first file; a picture comes before the recordings.
+func (p *Processor) sendCard(chatID int, text string, m media) error {
+	files := m.files()
+	if len(files) == 0 {
+		return p.tg.SendFormatted(chatID, text, telegram.ModeHTML)
+	}
+
+	for i, f := range files {
+		caption := ""
+		if i == 0 {
+			caption = text
+		}
+		if err := p.sendMedia(chatID, f, caption); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendMedia sends a card file by its file_id, falling back to the local copy
+// and, if there is none, to the caption alone so the quiz goes on.
+func (p *Processor) sendMedia(chatID int, att Attachment, caption string) error {
+	err := p.sendByID(chatID, att, caption)
+	if err == nil {
+		return nil
+	}
+
+	// Telegram may not know the file_id anymore, e.g. after the bot token changed
+	if p.blobs != nil {
+		if data, loadErr := p.blobs.Load(att.FileID); loadErr == nil {
+			if err = p.upload(chatID, att, data, caption); err == nil {
+				return nil
+			}
+		}
+	}
+
+	p.logger.Warn("can't send card file", "file", att.FileID, "error", err)
+	if caption == "" {
+		return nil
+	}
+	return p.tg.SendFormatted(chatID, caption, telegram.ModeHTML)
+}
+
+func (p *Processor) sendByID(chatID int, att Attachment, caption string) error {
+	switch att.Kind {
+	case AttachVoice:
+		return p.tg.SendVoice(chatID, att.FileID, caption, telegram.ModeHTML)
+	case AttachAudio:
+		return p.tg.SendAudio(chatID, att.FileID, caption, telegram.ModeHTML)
+	default:
+		return p.tg.SendPhoto(chatID, att.FileID, caption, telegram.ModeHTML)
+	}
+}
+
+func (p *Processor) upload(chatID int, att Attachment, data []byte, caption string) error {
+	name := att.FileID + att.Kind.fileExt()
+	switch att.Kind {
+	case AttachVoice:
+		return p.tg.UploadVoice(chatID, name, data, caption, telegram.ModeHTML)
+	case AttachAudio:
+		return p.tg.UploadAudio(chatID, name, data, caption, telegram.ModeHTML)
+	default:
+		return p.tg.UploadPhoto(chatID, name, data, caption, telegram.ModeHTML)
+	}
+}
+
+// cutPrefixFold is strings.CutPrefix ignoring case
+func cutPrefixFold(s, prefix string) (string, bool) {
+	if !hasPrefixFold(s, prefix) {
+		return s, false
+	}
+	return s[len(prefix):], true
+}
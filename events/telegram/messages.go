@@ -1,27 +1,100 @@
 package telegram
 
+// Message keys of the i18n catalog; the texts live in i18n/locales/*.json.
+// Messages with a count pick their plural form by the first integer argument.
 const (
-	msgUnknownCommand = "Sorry, I didn't understand that. Type /help for usage."
-	msgHelp           = `Usage:
-/save - save a flashcards under a name
-/get - retrieve saved text
-/list - list all saved names
-/help - for usage
-/delete - to delete saved cards
-/next - to show answer
-`
-	msgHello           = "Welcome! Use /help to see commands."
-	msgAlreadyExists   = "An entry with that name already exists."
-	msgSaved           = "Saved!"
-	msgNoSavedItems    = "No entries found by that name."
-	msgUsageGet        = "Usage: /get"
-	msgInvalidFormat   = "Invalid format!"
-	msgSaveCmdResponse = "Great! Please send your Q&A in this format:\n" +
-		"q:<question1> \n a:<answer1> \n q:<question2> \n a:<answer2> ..."
-	msgNoSuchItem     = "I couldn't find a flashcards by that name."
-	msgDeleteResponse = "Sure! Please send me the name of the flashcard you want to delete."
-	msgGetCmdResponse = "Please send a name of the flashcards to get."
-	msgQuizComplete   = "Quiz is finished"
-	msgSaveName       = "Got your Q&A. Now please send the **name** you want to save this under."
-	msgNoActive       = "No active quiz—send /get first."
+	msgUnknownCommand      = "unknown_command"
+	msgHello               = "hello"
+	msgAlreadyExists       = "already_exists"
+	msgSaved               = "saved"
+	msgNoSavedItems        = "no_saved_items"
+	msgUsageGet            = "usage_get"
+	msgInvalidFormat       = "invalid_format"
+	msgSaveCmdResponse     = "save_cmd_response"
+	msgDeleteResponse      = "delete_response"
+	msgGetCmdResponse      = "get_cmd_response"
+	msgQuizComplete        = "quiz_complete"
+	msgSaveName            = "save_name"
+	msgNoActive            = "no_active"
+	msgSettingsCmdResponse = "settings_cmd_response"
+	msgUsageSettings       = "usage_settings"
+	msgBadArguments        = "bad_arguments"
+	msgNoWrongCards        = "no_wrong_cards"
+	msgShuffled            = "shuffled"
+	msgCorrect             = "correct"
+	msgWrong               = "wrong"
+	msgCancelled           = "cancelled"
+	msgNothingToCancel     = "nothing_to_cancel"
+	msgNoStats             = "no_stats"
+	msgNoDueCards          = "no_due_cards"
+	msgUsageRemind         = "usage_remind"
+	msgUnknownTimeZone     = "unknown_time_zone"
+	msgReminderSet         = "reminder_set"
+	msgReminderOff         = "reminder_off"
+	msgUsageShare          = "usage_share"
+	msgUsageUnshare        = "usage_unshare"
+	msgUnshared            = "unshared"
+	msgUsageCopy           = "usage_copy"
+	msgUsageSubscribe      = "usage_subscribe"
+	msgShared              = "shared"
+	msgSharedDeck          = "shared_deck"
+	msgNoShare             = "no_share"
+	msgNameTaken           = "name_taken"
+	msgCopied              = "copied"
+	msgSubscribed          = "subscribed"
+	msgUnsubscribed        = "unsubscribed"
+	msgOwnDeck             = "own_deck"
+	msgAdminsOnly          = "admins_only"
+	msgGroupsOnly          = "groups_only"
+	msgNoScores            = "no_scores"
+	msgGroupCorrect        = "group_correct"
+	msgUsageAdd            = "usage_add"
+	msgUsageEdit           = "usage_edit"
+	msgSendCards           = "send_cards"
+	msgCardsChanged        = "cards_changed"
+	msgCardsAdded          = "cards_added"
+	msgUsageUnsubscribe    = "usage_unsubscribe"
+	msgUsageFork           = "usage_fork"
+	msgNotSubscribed       = "not_subscribed"
+	msgShareRevoked        = "share_revoked"
+	msgForked              = "forked"
+	msgDialogExpired       = "dialog_expired"
+	msgNoGenerator         = "no_generator"
+	msgUsageGenerate       = "usage_generate"
+	msgGenerating          = "generating"
+	msgGenerateFailed      = "generate_failed"
+	msgGeneratedPreview    = "generated_preview"
+	msgDocumentTooBig      = "document_too_big"
+	msgUnreadableDocument  = "unreadable_document"
+	msgDocumentTruncated   = "document_truncated"
+	msgMediaWithoutCard    = "media_without_card"
+	msgListHeader          = "list_header"
+	msgListLine            = "list_line"
+	msgSubscribedMark      = "subscribed_mark"
+	msgNeverStudied        = "never_studied"
+	msgStudiedToday        = "studied_today"
+	msgLastStudied         = "last_studied"
+	msgPrevPage            = "prev_page"
+	msgNextPage            = "next_page"
+	msgHelpHeader          = "help_header"
+	msgHelpNotes           = "help_notes"
+	msgLanguageName        = "language_name"
+	msgDateLayout          = "date_layout"
+	msgSettingsChanged     = "settings_changed"
+	msgDeleted             = "deleted"
+	msgReminder            = "reminder"
+	msgLeaderboardHeader   = "leaderboard_header"
+	msgLeaderboardLine     = "leaderboard_line"
+	msgStatsToday          = "stats_today"
+	msgStatsStreak         = "stats_streak"
+	msgStatsDecks          = "stats_decks"
+	msgStatsDeckLine       = "stats_deck_line"
+	msgStatsHardest        = "stats_hardest"
+	msgStatsCardLine       = "stats_card_line"
+	msgStatsActivity       = "stats_activity"
+	msgLanguageCurrent     = "language_current"
+	msgLanguageSet         = "language_set"
+	msgLanguageAuto        = "language_auto"
+	msgUnknownLanguage     = "unknown_language"
+	msgInternalError       = "internal_error"
 )
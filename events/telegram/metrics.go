@@ -0,0 +1,32 @@
+package telegram
+
+import "flashcard/lib/metrics"
+
+var (
+	updatesTotal = metrics.Default.Counter(
+		"flashcard_updates_total",
+		"Updates received by type, once however often they are retried.",
+		"type",
+	)
+	commandsTotal = metrics.Default.Counter(
+		"flashcard_commands_total",
+		"Commands received by name, \"unknown\" for commands the bot doesn't have. Retries don't count again.",
+		"command",
+	)
+	activeSessions = metrics.Default.Gauge(
+		"flashcard_active_sessions",
+		"Chats with a quiz session in progress.",
+	)
+	pendingDialogs = metrics.Default.Gauge(
+		"flashcard_pending_dialogs",
+		"Dialogs waiting for the user's answer.",
+	)
+)
+
+// updateGauges publishes the size of the processor's state. The maps are
+// only touched by the consumer goroutine, so they are read here rather
+// than when metrics are served.
+func (p *Processor) updateGauges() {
+	activeSessions.Set(float64(len(p.sessions)))
+	pendingDialogs.Set(float64(len(p.pending)))
+}
@@ -0,0 +1,47 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"flashcard/events"
+	"flashcard/storage"
+)
+
+func TestOwnerWithoutUsername(t *testing.T) {
+	p, s, _ := newTestProcessor(t)
+
+	ann := Meta{ChatID: 1, ChatType: "private", UserID: 1, FirstName: "Ann"}
+	ben := Meta{ChatID: 2, ChatType: "private", UserID: 2, FirstName: "Ben"}
+	for i, text := range []string{SaveCmd + " spanish", "q: hola\na: hello"} {
+		if err := p.Process(events.Event{ID: i + 1, Type: events.Message, Text: text, Meta: ann}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx := context.Background()
+	if _, err := s.Get(ctx, ann.owner(), "spanish"); err != nil {
+		t.Errorf("Ann's deck: %v", err)
+	}
+	if _, err := s.Get(ctx, ben.owner(), "spanish"); !errors.Is(err, storage.ErrNoSavedItems) {
+		t.Errorf("Ben sees Ann's deck: %v", err)
+	}
+}
+
+func TestClaimOwnerOnFirstMessage(t *testing.T) {
+	p, s, _ := newTestProcessor(t)
+	ctx := context.Background()
+
+	// as saved before decks were kept by user id
+	old := &storage.Item{UserName: testMeta.UserName, Name: "spanish", Content: "q: hola\na: hello"}
+	if err := s.Save(ctx, old); err != nil {
+		t.Fatal(err)
+	}
+
+	mustSend(t, p, 1, ListCmd)
+
+	if _, err := s.Get(ctx, testMeta.owner(), "spanish"); err != nil {
+		t.Errorf("the deck didn't move to the user id: %v", err)
+	}
+}
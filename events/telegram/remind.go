@@ -0,0 +1,76 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"flashcard/lib/e"
+	"flashcard/storage"
+)
+
+// defaultTimeZone is used when /remind is given only a time
+const defaultTimeZone = "UTC"
+
+func (p *Processor) cmdRemind(chatID int, user string, cmd command) (err error) {
+	defer func() { err = e.WrapIfErr("set reminder", err) }()
+
+	ctx := context.Background()
+
+	switch {
+	case len(cmd.args) == 0:
+		r, err := p.storage.GetReminder(ctx, user)
+		if errors.Is(err, storage.ErrNoReminder) {
+			return p.send(chatID, msgUsageRemind)
+		}
+		if err != nil {
+			return err
+		}
+		return p.send(chatID, msgReminderSet, r.Minute/60, r.Minute%60, r.TimeZone)
+
+	case len(cmd.args) == 1 && strings.EqualFold(cmd.args[0], "off"):
+		if err := p.storage.RemoveReminder(ctx, user); err != nil {
+			return err
+		}
+		return p.send(chatID, msgReminderOff)
+	}
+
+	if len(cmd.args) > 2 {
+		return p.send(chatID, msgUsageRemind)
+	}
+
+	at, err := time.Parse("15:04", cmd.args[0])
+	if err != nil {
+		return p.send(chatID, msgUsageRemind)
+	}
+
+	tz := defaultTimeZone
+	if len(cmd.args) == 2 {
+		tz = cmd.args[1]
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return p.send(chatID, msgUnknownTimeZone)
+	}
+
+	r := &storage.Reminder{
+		UserName: user,
+		ChatID:   chatID,
+		Minute:   at.Hour()*60 + at.Minute(),
+		TimeZone: loc.String(),
+	}
+	if err := p.storage.SetReminder(ctx, r); err != nil {
+		return err
+	}
+
+	// a time already past today starts tomorrow, not within the next minute
+	now := time.Now().In(loc)
+	if now.Hour()*60+now.Minute() >= r.Minute {
+		if err := p.storage.MarkReminded(ctx, user, now.Format(storage.DayLayout)); err != nil {
+			return err
+		}
+	}
+
+	return p.send(chatID, msgReminderSet, at.Hour(), at.Minute(), r.TimeZone)
+}
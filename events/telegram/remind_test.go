@@ -0,0 +1,24 @@
+package telegram
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"flashcard/storage"
+)
+
+func TestRemindPastTimeStartsTomorrow(t *testing.T) {
+	p, s, _ := newTestProcessor(t)
+
+	// midnight has always passed
+	mustSend(t, p, 1, RemindCmd+" 00:00 UTC")
+
+	r, err := s.GetReminder(context.Background(), testMeta.owner())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if today := time.Now().UTC().Format(storage.DayLayout); r.LastSent != today {
+		t.Errorf("last sent %q, want today %q", r.LastSent, today)
+	}
+}
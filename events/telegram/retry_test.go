@@ -0,0 +1,381 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"flashcard/clients/telegram"
+	"flashcard/events"
+	"flashcard/i18n"
+	"flashcard/lib/metrics"
+	"flashcard/storage"
+	"flashcard/storage/sqlite"
+)
+
+var errLocked = errors.New("database is locked")
+
+// lockedStorage fails the next saves and reviews like a busy database
+type lockedStorage struct {
+	*sqlite.Storage
+	saveFails   int
+	reviewFails int
+	panics      bool // panic on the next review instead
+}
+
+func (s *lockedStorage) Save(ctx context.Context, it *storage.Item) error {
+	if s.saveFails > 0 {
+		s.saveFails--
+		return errLocked
+	}
+	return s.Storage.Save(ctx, it)
+}
+
+func (s *lockedStorage) AddReview(ctx context.Context, r *storage.Review) error {
+	if s.panics {
+		s.panics = false
+		panic("broken review")
+	}
+	if s.reviewFails > 0 {
+		s.reviewFails--
+		return errLocked
+	}
+	return s.Storage.AddReview(ctx, r)
+}
+
+// botAPI is a fake Bot API that remembers the texts the bot sent
+type botAPI struct {
+	mu        sync.Mutex
+	sent      []string
+	failText  string // answer a sendMessage of this text with an error
+	sendFails int    // how many times to do so
+}
+
+func (b *botAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if strings.HasSuffix(r.URL.Path, "/sendMessage") {
+		if b.sendFails > 0 && r.URL.Query().Get("text") == b.failText {
+			b.sendFails--
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"ok":false,"error_code":500,"description":"Internal Server Error"}`))
+			return
+		}
+		b.sent = append(b.sent, r.URL.Query().Get("text"))
+	}
+	_, _ = w.Write([]byte(`{"ok":true,"result":{}}`))
+}
+
+func (b *botAPI) last() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.sent) == 0 {
+		return ""
+	}
+	return b.sent[len(b.sent)-1]
+}
+
+func newTestProcessor(t *testing.T) (*Processor, *lockedStorage, *botAPI) {
+	t.Helper()
+
+	api := &botAPI{}
+	srv := httptest.NewTLSServer(api)
+	t.Cleanup(srv.Close)
+
+	// the client always speaks https with the default transport
+	transport := http.DefaultTransport
+	http.DefaultTransport = srv.Client().Transport
+	t.Cleanup(func() { http.DefaultTransport = transport })
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sqlite.New(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	s := &lockedStorage{Storage: db}
+
+	catalog, err := i18n.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := New(telegram.New(u.Host, "token", time.Second), s, 0, nil, nil, catalog)
+	return p, s, api
+}
+
+var testMeta = Meta{ChatID: 1, ChatType: "private", UserID: 7, UserName: "alice", LanguageCode: "en"}
+
+// send processes text as the next update from testMeta
+func send(t *testing.T, p *Processor, id int, text string) error {
+	t.Helper()
+	return p.Process(events.Event{ID: id, Type: events.Message, Text: text, Meta: testMeta})
+}
+
+func mustSend(t *testing.T, p *Processor, id int, text string) {
+	t.Helper()
+	if err := send(t, p, id, text); err != nil {
+		t.Fatalf("update %d: %v", id, err)
+	}
+}
+
+func TestRetryLockedSave(t *testing.T) {
+	p, s, api := newTestProcessor(t)
+
+	mustSend(t, p, 1, SaveCmd)
+	mustSend(t, p, 2, "q: hola\na: hello")
+
+	s.saveFails = 1
+	if err := send(t, p, 3, "spanish"); !errors.Is(err, errLocked) {
+		t.Fatalf("want the locked error, got %v", err)
+	}
+
+	// the consumer retries the same update
+	mustSend(t, p, 3, "spanish")
+
+	if want := p.catalog.Text("en", msgSaved); api.last() != want {
+		t.Errorf("last reply %q, want %q", api.last(), want)
+	}
+	if _, err := s.Get(context.Background(), testMeta.owner(), "spanish"); err != nil {
+		t.Errorf("deck wasn't saved: %v", err)
+	}
+}
+
+func TestRetryFailedSendKeepsCard(t *testing.T) {
+	p, s, api := newTestProcessor(t)
+
+	mustSend(t, p, 1, SaveCmd+" spanish")
+	mustSend(t, p, 2, "q: hola\na: hello\n\nq: adios\na: bye")
+	mustSend(t, p, 3, GetCmd+" spanish")
+
+	// the answer is graded, then asking the next card fails
+	api.failText, api.sendFails = "adios", 1
+	if err := send(t, p, 4, "hello"); err == nil {
+		t.Fatal("want an error from the failed send")
+	}
+	if got := p.sessions[testMeta.ChatID].idx; got != 0 {
+		t.Fatalf("session moved to card %d after a failed event", got)
+	}
+
+	mustSend(t, p, 4, "hello")
+	if want := p.catalog.Text("en", msgCorrect); !containsSent(api, want) {
+		t.Errorf("the retried answer wasn't graded correct, sent %q", api.sent)
+	}
+	if got := p.sessions[testMeta.ChatID].idx; got != 1 {
+		t.Errorf("session is at card %d, want 1", got)
+	}
+
+	reviews, err := s.Reviews(context.Background(), testMeta.owner(), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reviews) != 1 || reviews[0].Card != "hola" || !reviews[0].Correct {
+		t.Errorf("want one correct review of hola, got %+v", reviews)
+	}
+}
+
+func TestPanicRestoresSession(t *testing.T) {
+	p, s, _ := newTestProcessor(t)
+
+	mustSend(t, p, 1, SaveCmd+" spanish")
+	mustSend(t, p, 2, "q: hola\na: hello\n\nq: adios\na: bye")
+	mustSend(t, p, 3, GetCmd+" spanish")
+
+	s.panics = true
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Error("the panic was swallowed")
+			}
+		}()
+		_ = send(t, p, 4, "hello")
+	}()
+
+	if got := p.sessions[testMeta.ChatID].idx; got != 0 {
+		t.Errorf("session moved to card %d after a panic", got)
+	}
+	if p.failed != 4 {
+		t.Errorf("failed update is %d, want 4", p.failed)
+	}
+}
+
+func TestRetryFailedSendAddsCardsOnce(t *testing.T) {
+	p, s, api := newTestProcessor(t)
+
+	mustSend(t, p, 1, SaveCmd+" spanish")
+	mustSend(t, p, 2, "q: hola\na: hello\n\nq: adios\na: bye")
+	mustSend(t, p, 3, ShareCmd+" spanish")
+	sh, err := s.ShareOf(context.Background(), testMeta.owner(), "spanish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob := Meta{ChatID: 2, ChatType: "private", UserID: 8, UserName: "bob", LanguageCode: "en"}
+	if err := p.Process(events.Event{ID: 4, Type: events.Message, Text: SubscribeCmd + " " + sh.Code, Meta: bob}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the cards are stored, then confirming it fails
+	api.failText, api.sendFails = p.catalog.Text("en", msgCardsChanged, "spanish", 3), 1
+	if err := send(t, p, 5, AddCmd+" spanish\nq: gracias\na: thanks"); err == nil {
+		t.Fatal("want an error from the failed send")
+	}
+	mustSend(t, p, 5, AddCmd+" spanish\nq: gracias\na: thanks")
+
+	item, err := s.Get(context.Background(), testMeta.owner(), "spanish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(extractQA(item.Content)); got != 3 {
+		t.Errorf("deck has %d cards after the retry, want 3", got)
+	}
+	if !containsSent(api, api.failText) {
+		t.Errorf("the retry didn't confirm the change, sent %q", api.sent)
+	}
+
+	notified := 0
+	for _, text := range api.sent {
+		if text == p.catalog.Text("en", msgCardsAdded, "spanish", 1) {
+			notified++
+		}
+	}
+	if notified != 1 {
+		t.Errorf("subscriber notified %d times, want once", notified)
+	}
+}
+
+func TestRetryFailedSendForksOnce(t *testing.T) {
+	p, s, api := newTestProcessor(t)
+
+	mustSend(t, p, 1, SaveCmd+" spanish")
+	mustSend(t, p, 2, "q: hola\na: hello")
+	mustSend(t, p, 3, ShareCmd+" spanish")
+	sh, err := s.ShareOf(context.Background(), testMeta.owner(), "spanish")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bob := Meta{ChatID: 2, ChatType: "private", UserID: 8, UserName: "bob", LanguageCode: "en"}
+	sendAs := func(id int, text string) error {
+		return p.Process(events.Event{ID: id, Type: events.Message, Text: text, Meta: bob})
+	}
+	if err := sendAs(4, SubscribeCmd+" "+sh.Code); err != nil {
+		t.Fatal(err)
+	}
+
+	// the deck is copied and the subscription dropped, then the reply fails
+	api.failText, api.sendFails = p.catalog.Text("en", msgForked, "spanish"), 1
+	if err := sendAs(5, ForkCmd+" spanish"); err == nil {
+		t.Fatal("want an error from the failed send")
+	}
+	if err := sendAs(5, ForkCmd+" spanish"); err != nil {
+		t.Fatal(err)
+	}
+	if api.last() != api.failText {
+		t.Errorf("retried /fork answered %q, want %q", api.last(), api.failText)
+	}
+
+	// the same command as a new update still finds no subscription
+	if err := sendAs(6, ForkCmd+" spanish"); err != nil {
+		t.Fatal(err)
+	}
+	if want := p.catalog.Text("en", msgNotSubscribed); api.last() != want {
+		t.Errorf("second /fork answered %q, want %q", api.last(), want)
+	}
+}
+
+func TestRetryLockedReview(t *testing.T) {
+	p, s, _ := newTestProcessor(t)
+
+	mustSend(t, p, 1, SaveCmd+" spanish")
+	mustSend(t, p, 2, "q: hola\na: hello\n\nq: adios\na: bye")
+	mustSend(t, p, 3, GetCmd+" spanish")
+
+	s.reviewFails = 1
+	if err := send(t, p, 4, "hello"); !errors.Is(err, errLocked) {
+		t.Fatalf("want the locked error, got %v", err)
+	}
+	mustSend(t, p, 4, "hello")
+
+	if got := p.sessions[testMeta.ChatID].idx; got != 1 {
+		t.Errorf("session is at card %d, want 1", got)
+	}
+	reviews, err := s.Reviews(context.Background(), testMeta.owner(), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reviews) != 1 || reviews[0].Card != "hola" {
+		t.Errorf("want one review of hola, got %+v", reviews)
+	}
+}
+
+func TestRetryCountsCommandOnce(t *testing.T) {
+	p, s, _ := newTestProcessor(t)
+
+	mustSend(t, p, 1, SaveCmd+" spanish")
+	before := metricValue(t, `flashcard_commands_total{command="/save"}`)
+
+	s.saveFails = 1
+	if err := send(t, p, 2, "q: hola\na: hello"); !errors.Is(err, errLocked) {
+		t.Fatalf("want the locked error, got %v", err)
+	}
+	mustSend(t, p, 2, "q: hola\na: hello")
+	mustSend(t, p, 3, SaveCmd+" french")
+
+	// the failed update carried no command, so only the last /save counts
+	if got := metricValue(t, `flashcard_commands_total{command="/save"}`) - before; got != 1 {
+		t.Errorf("counted %v /save commands, want 1", got)
+	}
+
+	s.saveFails = 1
+	before = metricValue(t, `flashcard_commands_total{command="/save"}`)
+	if err := send(t, p, 4, SaveCmd+" german\nq: ja\na: yes"); !errors.Is(err, errLocked) {
+		t.Fatalf("want the locked error, got %v", err)
+	}
+	mustSend(t, p, 4, SaveCmd+" german\nq: ja\na: yes")
+	if got := metricValue(t, `flashcard_commands_total{command="/save"}`) - before; got != 1 {
+		t.Errorf("a retried /save counted %v times, want 1", got)
+	}
+}
+
+// metricValue reads a sample of the default registry, 0 if it has none yet
+func metricValue(t *testing.T, sample string) float64 {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	metrics.Default.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if v, ok := strings.CutPrefix(line, sample+" "); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return f
+		}
+	}
+	return 0
+}
+
+func containsSent(api *botAPI, text string) bool {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	for _, s := range api.sent {
+		if s == text {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,221 @@
+package telegram
+
+import (
+	"strings"
+
+	"flashcard/clients/telegram"
+	"flashcard/i18n"
+	"flashcard/lib/e"
+)
+
+// cmdHandler handles a single parsed command for the owner of the decks
+type cmdHandler func(chatID int, owner string, cmd command) error
+
+// cmdRoute is a command's handler and who may use it
+type cmdRoute struct {
+	handle cmdHandler
+	manage bool // changes the chat's decks, so only admins may use it in groups
+}
+
+// chatScope says in which chats a command is offered
+type chatScope int
+
+const (
+	scopePrivate chatScope = 1 << iota
+	scopeGroup
+
+	scopeAll = scopePrivate | scopeGroup
+)
+
+// cmdSpec describes a command once for the router, /help and the menu.
+// What the command does is the catalog message "cmd_<name>".
+type cmdSpec struct {
+	name   string // e.g. "/get"
+	args   string // usage after the name, for /help
+	scope  chatScope
+	hidden bool // routed, but left out of /help and the menu
+	route  cmdRoute
+}
+
+func (s cmdSpec) aboutKey() string {
+	return "cmd_" + strings.TrimPrefix(s.name, "/")
+}
+
+// registry lists every command in the order /help and the menu show them.
+func (p *Processor) registry() []cmdSpec {
+	return []cmdSpec{
+		{name: SaveCmd, args: "[name]", scope: scopeAll, route: cmdRoute{handle: p.cmdSave, manage: true}},
+		{name: GetCmd, args: "<name> [shuffle] [seed=N] [N] [wrong] [due]", scope: scopeAll, route: cmdRoute{handle: p.cmdGet}},
+		{name: ListCmd, scope: scopeAll, route: cmdRoute{handle: p.cmdList}},
+		{name: NextCmd, scope: scopeAll, route: cmdRoute{handle: p.cmdNext}},
+		{name: CancelCmd, scope: scopeAll, route: cmdRoute{handle: p.cmdCancel}},
+		{name: AddCmd, args: "<name>", scope: scopeAll, route: cmdRoute{handle: p.cmdAdd, manage: true}},
+		{name: EditCmd, args: "<name>", scope: scopeAll, route: cmdRoute{handle: p.cmdEdit, manage: true}},
+		{name: DeleteCmd, args: "[name]", scope: scopeAll, route: cmdRoute{handle: p.cmdDelete, manage: true}},
+		{name: SettingsCmd, args: "[name direction]", scope: scopeAll, route: cmdRoute{handle: p.cmdSettings, manage: true}},
+		{name: StatsCmd, scope: scopeAll, route: cmdRoute{handle: p.cmdStats}},
+		{name: RemindCmd, args: "<HH:MM> [time zone]", scope: scopeAll, route: cmdRoute{handle: p.cmdRemind, manage: true}},
+		{name: ShareCmd, args: "<name>", scope: scopeAll, route: cmdRoute{handle: p.cmdShare, manage: true}},
+		{name: UnshareCmd, args: "<name>", scope: scopeAll, route: cmdRoute{handle: p.cmdUnshare, manage: true}},
+		{name: CopyCmd, args: "<code> [name]", scope: scopeAll, route: cmdRoute{handle: p.cmdCopy, manage: true}},
+		{name: SubscribeCmd, args: "<code> [name]", scope: scopeAll, route: cmdRoute{handle: p.cmdSubscribe, manage: true}},
+		{name: UnsubscribeCmd, args: "<name>", scope: scopeAll, route: cmdRoute{handle: p.cmdUnsubscribe, manage: true}},
+		{name: ForkCmd, args: "<name>", scope: scopeAll, route: cmdRoute{handle: p.cmdFork, manage: true}},
+		{name: GenerateCmd, args: "<topic> [N]", scope: scopeAll, route: cmdRoute{handle: p.cmdGenerate, manage: true}},
+		{name: LeaderboardCmd, scope: scopeGroup, route: cmdRoute{handle: p.cmdLeaderboard}},
+		{name: LanguageCmd, args: "[code|auto]", scope: scopeAll, route: cmdRoute{handle: p.cmdLanguage}},
+		{name: HelpCmd, scope: scopeAll, route: cmdRoute{handle: p.cmdHelp}},
+		{name: StartCmd, hidden: true, scope: scopeAll, route: cmdRoute{handle: p.cmdStart}},
+	}
+}
+
+// CommandKeys lists the catalog keys that describe the advertised commands
+func CommandKeys() []string {
+	var keys []string
+	for _, s := range (&Processor{}).registry() {
+		if !s.hidden {
+			keys = append(keys, s.aboutKey())
+		}
+	}
+	return keys
+}
+
+func routes(specs []cmdSpec) map[string]cmdRoute {
+	res := make(map[string]cmdRoute, len(specs))
+	for _, s := range specs {
+		res[s.name] = s.route
+	}
+	return res
+}
+
+// scopeOf is the scope of the chat a message came from
+func scopeOf(m Meta) chatScope {
+	if m.isGroup() {
+		return scopeGroup
+	}
+	return scopePrivate
+}
+
+// helpText lists the commands advertised in chats of the given scope,
+// followed by the general notes
+func (p *Processor) helpText(specs []cmdSpec, scope chatScope) string {
+	var b strings.Builder
+
+	b.WriteString(p.text(msgHelpHeader) + "\n")
+	for _, s := range specs {
+		if s.hidden || s.scope&scope == 0 {
+			continue
+		}
+		b.WriteString(s.name)
+		if s.args != "" {
+			b.WriteString(" " + s.args)
+		}
+		b.WriteString(" - " + p.text(s.aboutKey()) + "\n")
+	}
+	b.WriteString("\n" + p.text(msgHelpNotes))
+
+	return b.String()
+}
+
+// menu is the command menu for chats of the given scope in lang
+func (p *Processor) menu(specs []cmdSpec, scope chatScope, lang string) []telegram.BotCommand {
+	var res []telegram.BotCommand
+	for _, s := range specs {
+		if s.hidden || s.scope&scope == 0 {
+			continue
+		}
+		res = append(res, telegram.BotCommand{
+			Command:     strings.TrimPrefix(s.name, "/"),
+			Description: p.catalog.Text(lang, s.aboutKey()),
+		})
+	}
+	return res
+}
+
+// RegisterCommands publishes the command menus of private and group chats
+// in every bundled language. The fallback language also serves users whose
+// language isn't bundled.
+func (p *Processor) RegisterCommands() error {
+	specs := p.registry()
+	scopes := []struct {
+		scope chatScope
+		tg    telegram.BotCommandScope
+	}{
+		{scopePrivate, telegram.ScopePrivateChats},
+		{scopeGroup, telegram.ScopeGroupChats},
+	}
+
+	for _, lang := range p.catalog.Locales() {
+		code := lang
+		if lang == i18n.Fallback {
+			code = ""
+		}
+		for _, sc := range scopes {
+			if err := p.tg.SetMyCommands(p.menu(specs, sc.scope, lang), sc.tg, code); err != nil {
+				return e.Wrap("can't register commands", err)
+			}
+		}
+	}
+	return nil
+}
+
+// route dispatches cmd to its handler
+func (p *Processor) route(chatID int, owner string, cmd command) (err error) {
+	defer func() { err = e.WrapIfErr("can't route command", err) }()
+
+	// "/cmd@OtherBot" in a group is meant for someone else
+	if cmd.mention != "" {
+		mine, err := p.isMe(cmd.mention)
+		if err != nil {
+			return err
+		}
+		if !mine {
+			return nil
+		}
+	}
+
+	r, ok := p.commands[cmd.name]
+	if !p.retrying {
+		if ok {
+			commandsTotal.Inc(cmd.name)
+		} else {
+			commandsTotal.Inc("unknown")
+		}
+	}
+	if !ok {
+		return p.send(chatID, msgUnknownCommand)
+	}
+
+	if r.manage && cmd.from.isGroup() {
+		admin, err := p.isAdmin(chatID, cmd.from.UserID)
+		if err != nil {
+			return err
+		}
+		if !admin {
+			return p.send(chatID, msgAdminsOnly)
+		}
+	}
+
+	return r.handle(chatID, owner, cmd)
+}
+
+// isMe reports whether name is this bot's username
+func (p *Processor) isMe(name string) (bool, error) {
+	bot, err := p.botUsername()
+	if err != nil {
+		return false, err
+	}
+	return strings.EqualFold(name, bot), nil
+}
+
+// botUsername returns the bot's username, asking Telegram only once
+func (p *Processor) botUsername() (string, error) {
+	if p.botName == "" {
+		me, err := p.tg.Me()
+		if err != nil {
+			return "", err
+		}
+		p.botName = me.UserName
+	}
+	return p.botName, nil
+}
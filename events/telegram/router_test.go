@@ -0,0 +1,31 @@
+package telegram
+
+import (
+	"strings"
+	"testing"
+
+	"flashcard/i18n"
+)
+
+func TestHelpTextScope(t *testing.T) {
+	catalog, err := i18n.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Processor{catalog: catalog, lang: i18n.Fallback}
+
+	private := p.helpText(p.registry(), scopeOf(Meta{ChatType: "private"}))
+	group := p.helpText(p.registry(), scopeOf(Meta{ChatType: "supergroup"}))
+
+	if strings.Contains(private, LeaderboardCmd) {
+		t.Errorf("private help lists %s", LeaderboardCmd)
+	}
+	if !strings.Contains(group, LeaderboardCmd) {
+		t.Errorf("group help misses %s", LeaderboardCmd)
+	}
+	for _, help := range []string{private, group} {
+		if !strings.Contains(help, GetCmd) || strings.Contains(help, StartCmd) {
+			t.Errorf("help should list %s but not %s:\n%s", GetCmd, StartCmd, help)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package telegram
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+
+	"flashcard/lib/e"
+	"flashcard/storage"
+)
+
+// shareCodeBytes gives 12 URL-safe characters, well within the 64 allowed in a deep link
+const shareCodeBytes = 9
+
+// deck finds a deck the user can read: their own one or a subscription.
+// A subscription to a deck its owner no longer shares gives ErrNoShare.
+func (p *Processor) deck(ctx context.Context, user, name string) (*storage.Item, error) {
+	item, err := p.storage.Get(ctx, user, name)
+	if !errors.Is(err, storage.ErrNoSavedItems) {
+		return item, err
+	}
+
+	sub, err := p.storage.GetSubscription(ctx, user, name)
+	if errors.Is(err, storage.ErrNoSubscription) {
+		return nil, storage.ErrNoSavedItems
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p.subscribedDeck(ctx, sub)
+}
+
+// subscribedDeck reads the deck a subscription follows while it is shared
+func (p *Processor) subscribedDeck(ctx context.Context, sub *storage.Subscription) (*storage.Item, error) {
+	item, err := p.storage.Get(ctx, sub.Owner, sub.Deck)
+	if err != nil {
+		return nil, err
+	}
+	if item.Visibility != storage.VisibilityShared {
+		return nil, storage.ErrNoShare
+	}
+	return item, nil
+}
+
+// deckNames lists the user's own decks followed by their subscriptions
+func (p *Processor) deckNames(ctx context.Context, user string) (own, subscribed []string, err error) {
+	own, err = p.storage.List(ctx, user)
+	if err != nil {
+		return nil, nil, err
+	}
+	subs, err := p.storage.Subscriptions(ctx, user)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, s := range subs {
+		subscribed = append(subscribed, s.Name)
+	}
+	return own, subscribed, nil
+}
+
+// nameTaken reports whether the user already has a deck or subscription called name
+func (p *Processor) nameTaken(ctx context.Context, user, name string) (bool, error) {
+	_, err := p.deck(ctx, user, name)
+	switch {
+	case errors.Is(err, storage.ErrNoSavedItems):
+		return false, nil
+	case errors.Is(err, storage.ErrNoShare):
+		return true, nil
+	}
+	return err == nil, err
+}
+
+func (p *Processor) cmdShare(chatID int, user string, cmd command) (err error) {
+	defer func() { err = e.WrapIfErr("share deck", err) }()
+
+	if len(cmd.args) == 0 {
+		return p.send(chatID, msgUsageShare)
+	}
+	ctx := context.Background()
+	name := joinArgs(cmd.args)
+
+	item, err := p.storage.Get(ctx, user, name)
+	if errors.Is(err, storage.ErrNoSavedItems) {
+		return p.send(chatID, msgNoSavedItems)
+	}
+	if err != nil {
+		return err
+	}
+
+	// sharing the same deck twice gives the same code
+	sh, err := p.storage.ShareOf(ctx, user, name)
+	if errors.Is(err, storage.ErrNoShare) {
+		sh = &storage.Share{Owner: user, Name: name, Author: cmd.from.displayName()}
+		if sh.Code, err = newShareCode(); err != nil {
+			return err
+		}
+		err = p.storage.CreateShare(ctx, sh)
+	}
+	if err != nil {
+		return err
+	}
+
+	if item.Visibility != storage.VisibilityShared {
+		item.Visibility = storage.VisibilityShared
+		if err := p.storage.Update(ctx, item); err != nil {
+			return err
+		}
+	}
+
+	bot, err := p.botUsername()
+	if err != nil {
+		return err
+	}
+
+	return p.send(chatID, msgShared, name, sh.Code, bot, sh.Code)
+}
+
+func (p *Processor) cmdUnshare(chatID int, user string, cmd command) (err error) {
+	defer func() { err = e.WrapIfErr("unshare deck", err) }()
+
+	if len(cmd.args) == 0 {
+		return p.send(chatID, msgUsageUnshare)
+	}
+	name := joinArgs(cmd.args)
+
+	item, err := p.storage.Get(context.Background(), user, name)
+	if errors.Is(err, storage.ErrNoSavedItems) {
+		return p.send(chatID, msgNoSavedItems)
+	}
+	if err != nil {
+		return err
+	}
+
+	// the code stays, so sharing again revives links already sent around
+	item.Visibility = storage.VisibilityPrivate
+	if err := p.storage.Update(context.Background(), item); err != nil {
+		return err
+	}
+	return p.send(chatID, msgUnshared, name)
+}
+
+// handleStartPayload shows a shared deck opened through a deep link
+func (p *Processor) handleStartPayload(chatID int, code string) (err error) {
+	defer func() { err = e.WrapIfErr("open share", err) }()
+
+	sh, item, err := p.sharedDeck(context.Background(), code)
+	if errors.Is(err, storage.ErrNoShare) {
+		return p.send(chatID, msgNoShare)
+	}
+	if err != nil {
+		return err
+	}
+
+	n := len(extractQA(item.Content))
+	return p.send(chatID, msgSharedDeck, item.Name, sh.Author, n, code, code)
+}
+
+func (p *Processor) cmdCopy(chatID int, user string, cmd command) (err error) {
+	defer func() { err = e.WrapIfErr("copy deck", err) }()
+
+	if len(cmd.args) == 0 {
+		return p.send(chatID, msgUsageCopy)
+	}
+	ctx := context.Background()
+
+	_, src, err := p.sharedDeck(ctx, cmd.args[0])
+	if errors.Is(err, storage.ErrNoShare) {
+		return p.send(chatID, msgNoShare)
+	}
+	if err != nil {
+		return err
+	}
+
+	name := src.Name
+	if len(cmd.args) > 1 {
+		name = joinArgs(cmd.args[1:])
+	}
+	taken, err := p.nameTaken(ctx, user, name)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return p.send(chatID, msgNameTaken, name, "/copy", cmd.args[0])
+	}
+
+	item := &storage.Item{
+		Name:      name,
+		Content:   src.Content,
+		UserName:  user,
+		Direction: src.Direction,
+	}
+	if err := p.storage.Save(ctx, item); err != nil {
+		return err
+	}
+
+	return p.send(chatID, msgCopied, name)
+}
+
+func (p *Processor) cmdSubscribe(chatID int, user string, cmd command) (err error) {
+	defer func() { err = e.WrapIfErr("subscribe", err) }()
+
+	if len(cmd.args) == 0 {
+		return p.send(chatID, msgUsageSubscribe)
+	}
+	ctx := context.Background()
+
+	sh, src, err := p.sharedDeck(ctx, cmd.args[0])
+	if errors.Is(err, storage.ErrNoShare) {
+		return p.send(chatID, msgNoShare)
+	}
+	if err != nil {
+		return err
+	}
+	if sh.Owner == user {
+		return p.send(chatID, msgOwnDeck)
+	}
+
+	name := src.Name
+	if len(cmd.args) > 1 {
+		name = joinArgs(cmd.args[1:])
+	}
+	taken, err := p.nameTaken(ctx, user, name)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return p.send(chatID, msgNameTaken, name, "/subscribe", cmd.args[0])
+	}
+
+	sub := &storage.Subscription{
+		UserName: user,
+		ChatID:   chatID,
+		Name:     name,
+		Owner:    sh.Owner,
+		Deck:     sh.Name,
+	}
+	if err := p.storage.Subscribe(ctx, sub); err != nil {
+		return err
+	}
+
+	return p.send(chatID, msgSubscribed, name)
+}
+
+// unsubscribe removes a subscribed deck from the user's decks
+func (p *Processor) unsubscribe(chatID int, user, name string) (err error) {
+	defer func() { err = e.WrapIfErr("unsubscribe", err) }()
+
+	_, err = p.storage.GetSubscription(context.Background(), user, name)
+	if errors.Is(err, storage.ErrNoSubscription) {
+		return p.send(chatID, msgNoSavedItems)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := p.storage.Unsubscribe(context.Background(), user, name); err != nil {
+		return err
+	}
+	if err := p.storage.RemoveReviews(context.Background(), user, name); err != nil {
+		return err
+	}
+	return p.send(chatID, msgUnsubscribed, name)
+}
+
+func (p *Processor) cmdUnsubscribe(chatID int, user string, cmd command) error {
+	if len(cmd.args) == 0 {
+		return p.send(chatID, msgUsageUnsubscribe)
+	}
+	return p.unsubscribe(chatID, user, joinArgs(cmd.args))
+}
+
+// cmdFork turns a subscription into a private copy under the same name.
+// Reviews are stored by that name, so the progress carries over.
+func (p *Processor) cmdFork(chatID int, user string, cmd command) (err error) {
+	defer func() { err = e.WrapIfErr("fork deck", err) }()
+
+	if len(cmd.args) == 0 {
+		return p.send(chatID, msgUsageFork)
+	}
+	ctx := context.Background()
+	name := joinArgs(cmd.args)
+
+	sub, err := p.storage.GetSubscription(ctx, user, name)
+	if errors.Is(err, storage.ErrNoSubscription) {
+		if p.retrying && p.forked(ctx, user, name) {
+			// the deck was copied before the reply failed
+			return p.send(chatID, msgForked, name)
+		}
+		return p.send(chatID, msgNotSubscribed)
+	}
+	if err != nil {
+		return err
+	}
+
+	src, err := p.subscribedDeck(ctx, sub)
+	if errors.Is(err, storage.ErrNoShare) {
+		return p.send(chatID, msgShareRevoked, name, name)
+	}
+	if err != nil {
+		return err
+	}
+
+	item := &storage.Item{
+		Name:      name,
+		Content:   src.Content,
+		UserName:  user,
+		Direction: src.Direction,
+	}
+	if err := p.storage.Save(ctx, item); err != nil {
+		return err
+	}
+	if err := p.storage.Unsubscribe(ctx, user, name); err != nil {
+		return err
+	}
+
+	return p.send(chatID, msgForked, name)
+}
+
+// forked reports whether the user owns a deck with the name
+func (p *Processor) forked(ctx context.Context, user, name string) bool {
+	_, err := p.storage.Get(ctx, user, name)
+	return err == nil
+}
+
+// sharedDeck resolves a share code into the deck it points at
+func (p *Processor) sharedDeck(ctx context.Context, code string) (*storage.Share, *storage.Item, error) {
+	sh, err := p.storage.GetShare(ctx, code)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	item, err := p.storage.Get(ctx, sh.Owner, sh.Name)
+	if errors.Is(err, storage.ErrNoSavedItems) {
+		return nil, nil, storage.ErrNoShare
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if item.Visibility != storage.VisibilityShared {
+		return nil, nil, storage.ErrNoShare
+	}
+	return sh, item, nil
+}
+
+func newShareCode() (string, error) {
+	b := make([]byte, shareCodeBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", e.Wrap("can't generate share code", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,54 @@
+package telegram
+
+import (
+	"context"
+	"testing"
+
+	"flashcard/events"
+)
+
+func TestUnshareRevokesSubscriptions(t *testing.T) {
+	p, s, api := newTestProcessor(t)
+
+	mustSend(t, p, 1, SaveCmd+" spanish")
+	mustSend(t, p, 2, "q: hola\na: hello")
+	mustSend(t, p, 3, ShareCmd+" spanish")
+
+	sh, err := s.ShareOf(context.Background(), testMeta.owner(), "spanish")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bob := Meta{ChatID: 2, ChatType: "private", UserID: 8, UserName: "bob", LanguageCode: "en"}
+	sendAs := func(id int, text string) {
+		t.Helper()
+		if err := p.Process(events.Event{ID: id, Type: events.Message, Text: text, Meta: bob}); err != nil {
+			t.Fatalf("update %d: %v", id, err)
+		}
+	}
+
+	sendAs(4, SubscribeCmd+" "+sh.Code)
+	sendAs(5, GetCmd+" spanish")
+	if api.last() != "hola" {
+		t.Fatalf("subscriber wasn't asked the first card, got %q", api.last())
+	}
+	sendAs(6, CancelCmd)
+
+	mustSend(t, p, 7, UnshareCmd+" spanish")
+
+	sendAs(8, GetCmd+" spanish")
+	if want := p.catalog.Text("en", msgShareRevoked, "spanish", "spanish"); api.last() != want {
+		t.Errorf("after /unshare got %q, want %q", api.last(), want)
+	}
+	sendAs(9, ForkCmd+" spanish")
+	if want := p.catalog.Text("en", msgShareRevoked, "spanish", "spanish"); api.last() != want {
+		t.Errorf("/fork after /unshare got %q, want %q", api.last(), want)
+	}
+
+	// sharing again gives access back
+	mustSend(t, p, 10, ShareCmd+" spanish")
+	sendAs(11, GetCmd+" spanish")
+	if api.last() != "hola" {
+		t.Errorf("after sharing again got %q", api.last())
+	}
+}
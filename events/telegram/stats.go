@@ -0,0 +1,190 @@
+package telegram
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"flashcard/lib/e"
+	"flashcard/storage"
+)
+
+const (
+	activityDays = 30 // length of the activity sparkline
+	hardestCards = 5  // how many hardest cards /stats shows
+)
+
+var sparkBars = []rune("▁▂▃▄▅▆▇█")
+
+// stats is a summary of a user's review log
+type stats struct {
+	today    int
+	decks    []deckAccuracy
+	streak   int
+	hardest  []cardAccuracy
+	activity []int // reviews per day, oldest first, today last
+}
+
+type deckAccuracy struct {
+	name           string
+	correct, total int
+}
+
+type cardAccuracy struct {
+	deck, card     string
+	correct, total int
+}
+
+func (p *Processor) cmdStats(chatID int, user string, _ command) (err error) {
+	defer func() { err = e.WrapIfErr("show stats", err) }()
+
+	reviews, err := p.storage.Reviews(context.Background(), user, time.Time{})
+	if err != nil {
+		return err
+	}
+	if len(reviews) == 0 {
+		return p.send(chatID, msgNoStats)
+	}
+
+	return p.tg.SendMessage(chatID, p.statsText(computeStats(reviews, time.Now())))
+}
+
+// computeStats summarises reviews as of now
+func computeStats(reviews []storage.Review, now time.Time) stats {
+	today := day(now)
+	st := stats{activity: make([]int, activityDays)}
+
+	decks := make(map[string]*deckAccuracy)
+	cards := make(map[[2]string]*cardAccuracy)
+	studied := make(map[time.Time]bool)
+
+	for _, r := range reviews {
+		d := day(r.At)
+		studied[d] = true
+		if d.Equal(today) {
+			st.today++
+		}
+		if ago := daysBetween(d, today); ago >= 0 && ago < activityDays {
+			st.activity[activityDays-1-ago]++
+		}
+
+		da, ok := decks[r.Name]
+		if !ok {
+			da = &deckAccuracy{name: r.Name}
+			decks[r.Name] = da
+		}
+		ca, ok := cards[[2]string{r.Name, r.Card}]
+		if !ok {
+			ca = &cardAccuracy{deck: r.Name, card: r.Card}
+			cards[[2]string{r.Name, r.Card}] = ca
+		}
+		da.total++
+		ca.total++
+		if r.Correct {
+			da.correct++
+			ca.correct++
+		}
+	}
+
+	for _, da := range decks {
+		st.decks = append(st.decks, *da)
+	}
+	sort.Slice(st.decks, func(i, j int) bool { return st.decks[i].name < st.decks[j].name })
+
+	// a streak survives until the end of the day, so start from yesterday
+	// if nothing was studied today yet
+	d := today
+	if !studied[d] {
+		d = d.AddDate(0, 0, -1)
+	}
+	for studied[d] {
+		st.streak++
+		d = d.AddDate(0, 0, -1)
+	}
+
+	for _, ca := range cards {
+		if ca.correct < ca.total {
+			st.hardest = append(st.hardest, *ca)
+		}
+	}
+	sort.Slice(st.hardest, func(i, j int) bool {
+		a, b := st.hardest[i], st.hardest[j]
+		// lower accuracy first, then the more often missed card
+		if a.correct*b.total != b.correct*a.total {
+			return a.correct*b.total < b.correct*a.total
+		}
+		return a.total-a.correct > b.total-b.correct
+	})
+	if len(st.hardest) > hardestCards {
+		st.hardest = st.hardest[:hardestCards]
+	}
+
+	return st
+}
+
+func (p *Processor) statsText(st stats) string {
+	var b strings.Builder
+
+	b.WriteString(p.text(msgStatsToday, st.today) + "\n")
+	b.WriteString(p.text(msgStatsStreak, st.streak) + "\n")
+
+	b.WriteString("\n" + p.text(msgStatsDecks) + "\n")
+	for _, d := range st.decks {
+		b.WriteString(p.text(msgStatsDeckLine, d.name, percent(d.correct, d.total), d.correct, d.total) + "\n")
+	}
+
+	if len(st.hardest) > 0 {
+		b.WriteString("\n" + p.text(msgStatsHardest) + "\n")
+		for _, c := range st.hardest {
+			b.WriteString(p.text(msgStatsCardLine, c.deck, c.card, percent(c.correct, c.total), c.correct, c.total) + "\n")
+		}
+	}
+
+	b.WriteString("\n" + p.text(msgStatsActivity, activityDays) + "\n" + sparkline(st.activity))
+
+	return b.String()
+}
+
+// sparkline renders counts as a row of block characters
+func sparkline(counts []int) string {
+	max := 0
+	for _, c := range counts {
+		if c > max {
+			max = c
+		}
+	}
+
+	var b strings.Builder
+	for _, c := range counts {
+		switch {
+		case c == 0:
+			b.WriteRune('·')
+		default:
+			b.WriteRune(sparkBars[(c*len(sparkBars)-1)/max])
+		}
+	}
+	return b.String()
+}
+
+func percent(part, total int) int {
+	if total == 0 {
+		return 0
+	}
+	return part * 100 / total
+}
+
+// day truncates t to local midnight
+func day(t time.Time) time.Time {
+	y, m, d := t.Local().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
+
+// daysBetween counts calendar days from a to b, both already truncated by day
+func daysBetween(a, b time.Time) int {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	ua := time.Date(ay, am, ad, 0, 0, 0, 0, time.UTC)
+	ub := time.Date(by, bm, bd, 0, 0, 0, 0, time.UTC)
+	return int(ub.Sub(ua).Hours() / 24)
+}
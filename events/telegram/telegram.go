@@ -1,56 +1,162 @@
 package telegram
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"flashcard/clients/telegram"
 	"flashcard/events"
+	"flashcard/generator"
+	"flashcard/i18n"
 	"flashcard/lib/e"
 	"flashcard/storage"
+	"flashcard/storage/blob"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Processor struct {
-	tg              *telegram.Client
-	offset          int
-	storage         storage.Storage
-	pendingDelete   map[int]bool
-	pendingGet      map[int]bool
-	pendingSaveQA   map[int]*saveState // waiting for the Q&A
-	pendingSaveName map[int]*saveState // waiting for the final name
-	sessions        map[int]*session   // chatID → current session
-}
-type saveState struct {
-	rawQA string // the Q&A text the user sent
+	tg            *telegram.Client
+	offset        int  // next update to fetch
+	resumed       bool // offset was restored from storage
+	storage       storage.Storage
+	pending       map[dialogKey]*dialog // chat and user → dialog waiting for an answer
+	dialogTimeout time.Duration         // idle time after which a dialog is dropped
+	sessions      map[int]*session      // chatID → current session
+	generator     generator.Provider    // nil if generation isn't configured
+	blobs         *blob.Store           // local copies of card images, nil if disabled
+	catalog       *i18n.Catalog
+	lang          string       // locale of the event being processed
+	logger        *slog.Logger // with the fields of the event being processed
+	commands      map[string]cmdRoute
+	botName       string       // learned from getMe on first mention
+	claimed       map[int]bool // users whose username-keyed data was moved to their id
+	failed        int          // update id of the last event that failed
+	retrying      bool         // the event being processed failed before
 }
 
 // a single Q&A pair
-type qaPair struct{ Q, A string }
+type qaPair struct {
+	Q, A           string
+	QMedia, AMedia media // files shown with each side
+}
 
 // holds an in‐progress flashcard session
 type session struct {
+	user  string   // owner of the deck
+	deck  string   // deck name
 	pairs []qaPair // all Q&A
 	idx   int      // next index to reveal
+	group bool     // group quiz: the first correct answer scores
 }
 
 type Meta struct {
-	ChatID   int
-	UserName string
+	ChatID       int
+	ChatType     string
+	UserID       int
+	UserName     string
+	FirstName    string
+	LanguageCode string             // of the user's Telegram app
+	Document     *telegram.Document // attached file, if any
+	Attachment   *Attachment        // attached photo or recording, if any
+	CallbackID   string             // set for button presses
+	MessageID    int                // the message whose button was pressed
+}
+
+// isGroup reports whether the message came from a group chat
+func (m Meta) isGroup() bool {
+	return m.ChatType == "group" || m.ChatType == "supergroup"
+}
+
+// owner is who decks belong to: the group in group chats, the user otherwise.
+// Users are known by id, as not everyone has a username and it may change.
+func (m Meta) owner() string {
+	if m.isGroup() {
+		return groupOwner(m.ChatID)
+	}
+	return userOwner(m.UserID)
+}
+
+// displayName is how the user is called in group messages
+func (m Meta) displayName() string {
+	if m.UserName != "" {
+		return "@" + m.UserName
+	}
+	return m.FirstName
+}
+
+// groupOwner is the owner key of decks belonging to a group chat
+func groupOwner(chatID int) string {
+	return "chat:" + strconv.Itoa(chatID)
+}
+
+// userOwner is the owner key of a user's own decks
+func userOwner(userID int) string {
+	return "user:" + strconv.Itoa(userID)
 }
 
+func isGroupOwner(owner string) bool {
+	return strings.HasPrefix(owner, "chat:")
+}
+
+// claimOwner moves what older versions kept under the sender's username
+// to their id, once per user and run. Whoever holds a username now could
+// already read its decks, so they are the one to keep them.
+func (p *Processor) claimOwner(m Meta) error {
+	if m.UserName == "" || m.UserID == 0 || p.claimed[m.UserID] {
+		return nil
+	}
+	if err := p.storage.ClaimOwner(context.Background(), m.UserName, userOwner(m.UserID)); err != nil {
+		return err
+	}
+	p.claimed[m.UserID] = true
+	return nil
+}
+
+// updateIDsReset is how long Telegram keeps update_ids sequential without updates
+const updateIDsReset = 7 * 24 * time.Hour
+
 var ErrUnknownEventType = errors.New("unknown event type")
 var ErrUnknownMetaType = errors.New("unknown meta type")
 
-func New(client *telegram.Client, storage storage.Storage) *Processor {
-	return &Processor{tg: client,
-		storage:         storage,
-		pendingDelete:   make(map[int]bool),
-		pendingGet:      make(map[int]bool),
-		pendingSaveQA:   make(map[int]*saveState),
-		pendingSaveName: make(map[int]*saveState),
-		sessions:        make(map[int]*session),
+func New(
+	client *telegram.Client,
+	storage storage.Storage,
+	dialogTimeout time.Duration,
+	generator generator.Provider,
+	blobs *blob.Store,
+	catalog *i18n.Catalog,
+) *Processor {
+	p := &Processor{tg: client,
+		storage:       storage,
+		pending:       make(map[dialogKey]*dialog),
+		dialogTimeout: dialogTimeout,
+		sessions:      make(map[int]*session),
+		claimed:       make(map[int]bool),
+		generator:     generator,
+		blobs:         blobs,
+		catalog:       catalog,
+		lang:          i18n.Fallback,
+		logger:        slog.Default(),
 	}
+	p.commands = routes(p.registry())
+
+	return p
 }
 
 func (p *Processor) Fetch(limit int) ([]events.Event, error) {
+	// runs on every poll, so idle dialogs expire even when nobody writes
+	p.expireDialogs()
+	p.updateGauges()
+
+	if !p.resumed {
+		if err := p.resume(); err != nil {
+			return nil, e.Wrap("can't get events", err)
+		}
+	}
+
 	updates, err := p.tg.Updates(p.offset, limit)
 	if err != nil {
 		return nil, e.Wrap("can't get events", err)
@@ -62,17 +168,76 @@ func (p *Processor) Fetch(limit int) ([]events.Event, error) {
 	res := make([]events.Event, 0, len(updates))
 
 	for _, u := range updates {
-		res = append(res, event(u))
+		ev := event(u)
+		updatesTotal.Inc(ev.Type.String())
+		res = append(res, ev)
 	}
 
 	p.offset = updates[len(updates)-1].ID + 1
 
 	return res, nil
 }
-func (p *Processor) Process(event events.Event) error {
+
+// Process handles an event at most once, even if Telegram delivers it again
+// after a crash. An update counts as handled once it was processed or put
+// into the dead letters, so a failed update may be retried.
+func (p *Processor) Process(event events.Event) (err error) {
+	ctx := context.Background()
+	p.logger = slog.With(LogAttrs(event)...)
+
+	handled, err := p.storage.IsUpdateHandled(ctx, event.ID)
+	if err != nil {
+		return e.Wrap("can't process event", err)
+	}
+	if handled {
+		return nil
+	}
+
+	defer p.updateGauges()
+
+	p.retrying = event.ID == p.failed
+	before := p.snapshot(event)
+	defer func() {
+		// the event may be processed again, so it must find the dialog and
+		// the quiz as they were, not half answered, even after a panic
+		r := recover()
+		if err == nil && r == nil {
+			return
+		}
+		p.restore(before)
+		p.failed = event.ID
+		if r != nil {
+			panic(r)
+		}
+	}()
+
+	if err := p.process(event); err != nil {
+		return classify(err)
+	}
+
+	return e.WrapIfErr("can't process event", p.storage.MarkUpdateHandled(ctx, event.ID))
+}
+
+// resume continues after the last update handled before a restart
+func (p *Processor) resume() error {
+	last, at, err := p.storage.LastUpdate(context.Background())
+	if err != nil {
+		return err
+	}
+	// Telegram picks a random next update_id after a week without updates
+	if last != 0 && time.Since(at) < updateIDsReset {
+		p.offset = last + 1
+	}
+	p.resumed = true
+	return nil
+}
+
+func (p *Processor) process(event events.Event) error {
 	switch event.Type {
 	case events.Message:
 		return p.processMessage(event)
+	case events.Callback:
+		return p.processCallback(event)
 	default:
 		return e.Wrap("can't process message", ErrUnknownEventType)
 	}
@@ -84,7 +249,11 @@ func (p *Processor) processMessage(event events.Event) error {
 		return e.Wrap("can't process message", err)
 	}
 
-	if err := p.doCmd(event.Text, meta.ChatID, meta.UserName); err != nil {
+	p.lang = p.language(meta)
+	if err := p.claimOwner(meta); err != nil {
+		return e.Wrap("can't process message", err)
+	}
+	if err := p.doCmd(event.Text, meta); err != nil {
 		return e.Wrap("can't process message", err)
 	}
 
@@ -99,32 +268,105 @@ func meta(event events.Event) (Meta, error) {
 
 	return res, nil
 }
+
+// LogAttrs are the fields that tie log records to an event: the update id
+// and, if known, the chat and the user
+func LogAttrs(event events.Event) []any {
+	attrs := []any{"update", event.ID}
+	if m, err := meta(event); err == nil {
+		attrs = append(attrs, "chat", m.ChatID, "user", m.UserID)
+	}
+	return attrs
+}
+
+// SenderKey names the user who sent an event, e.g. for rate limiting,
+// or returns "" if the event has no sender
+func SenderKey(event events.Event) string {
+	m, err := meta(event)
+	if err != nil || m.UserID == 0 {
+		return ""
+	}
+	return strconv.Itoa(m.UserID)
+}
+
 func event(upd telegram.Update) events.Event {
 	updType := fetchType(upd)
+	// an Update always marshals, it was unmarshalled from JSON
+	raw, _ := json.Marshal(upd)
+
 	res := events.Event{
+		ID:   upd.ID,
 		Type: updType,
 		Text: fetchText(upd),
+		Raw:  raw,
 	}
 
-	if updType == events.Message {
+	switch updType {
+	case events.Message:
+		res.Meta = Meta{
+			ChatID:       upd.Message.Chat.ID,
+			ChatType:     upd.Message.Chat.Type,
+			UserID:       upd.Message.From.ID,
+			UserName:     upd.Message.From.UserName,
+			FirstName:    upd.Message.From.FirstName,
+			LanguageCode: upd.Message.From.LanguageCode,
+			Document:     upd.Message.Document,
+			Attachment:   attachment(upd.Message),
+		}
+	case events.Callback:
+		cq := upd.CallbackQuery
 		res.Meta = Meta{
-			ChatID:   upd.Message.Chat.ID,
-			UserName: upd.Message.From.UserName,
+			ChatID:       cq.Message.Chat.ID,
+			ChatType:     cq.Message.Chat.Type,
+			UserID:       cq.From.ID,
+			UserName:     cq.From.UserName,
+			FirstName:    cq.From.FirstName,
+			LanguageCode: cq.From.LanguageCode,
+			CallbackID:   cq.ID,
+			MessageID:    cq.Message.MessageID,
 		}
 	}
 	return res
 }
 
 func fetchType(upd telegram.Update) events.Type {
-	if upd.Message == nil {
+	switch {
+	case upd.Message != nil:
+		return events.Message
+	case upd.CallbackQuery != nil && upd.CallbackQuery.Message != nil:
+		// buttons of messages too old to be delivered can't be answered anyway
+		return events.Callback
+	default:
 		return events.Unknown
 	}
-	return events.Message
 }
 
 func fetchText(upd telegram.Update) string {
+	if upd.CallbackQuery != nil {
+		return upd.CallbackQuery.Data
+	}
 	if upd.Message == nil {
 		return ""
 	}
+	if upd.Message.Text == "" {
+		// files carry their text in the caption
+		return upd.Message.Caption
+	}
 	return upd.Message.Text
 }
+
+// attachment picks the photo or recording of a message, if any
+func attachment(msg *telegram.IncomingMessage) *Attachment {
+	switch {
+	case len(msg.Photo) > 0:
+		// sizes come smallest first
+		ph := msg.Photo[len(msg.Photo)-1]
+		return &Attachment{Kind: AttachPhoto, FileID: ph.FileID, Size: ph.FileSize}
+	case msg.Voice != nil:
+		return &Attachment{Kind: AttachVoice, FileID: msg.Voice.FileID, Size: msg.Voice.FileSize}
+	case msg.Audio != nil:
+		return &Attachment{Kind: AttachAudio, FileID: msg.Audio.FileID, Size: msg.Audio.FileSize}
+	default:
+		return nil
+	}
+}
@@ -1,5 +1,10 @@
 package events
 
+import (
+	"errors"
+	"fmt"
+)
+
 type Fetcher interface {
 	Fetch(limit int) ([]Event, error)
 }
@@ -8,15 +13,53 @@ type Processor interface {
 	Process(e Event) error
 }
 
+// ProcessorFunc lets an ordinary function be used as a Processor
+type ProcessorFunc func(e Event) error
+
+func (f ProcessorFunc) Process(e Event) error {
+	return f(e)
+}
+
+// DeadLetters keeps events that could not be processed, so they can be
+// inspected and replayed later
+type DeadLetters interface {
+	DeadLetter(e Event, attempts int, reason error) error
+}
+
+// ErrPermanent marks processing errors that retrying the event won't fix
+var ErrPermanent = errors.New("permanent error")
+
+// Permanent marks err so that errors.Is(err, ErrPermanent) holds
+func Permanent(err error) error {
+	if err == nil || errors.Is(err, ErrPermanent) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrPermanent, err)
+}
+
 type Type int
 
 const (
 	Unknown Type = iota
 	Message
+	Callback // a press of an inline button; Text is the button's data
 )
 
+func (t Type) String() string {
+	switch t {
+	case Message:
+		return "message"
+	case Callback:
+		return "callback"
+	default:
+		return "unknown"
+	}
+}
+
 type Event struct {
+	ID   int // the source's id of the event, e.g. a Telegram update_id
 	Type Type
 	Text string
 	Meta interface{}
+	Raw  []byte // the event as the source sent it, to replay it later
 }
@@ -0,0 +1,154 @@
+package document
+
+import (
+	"errors"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// ErrUnsupported is returned for document types that can't be read
+	ErrUnsupported = errors.New("unsupported document type")
+	// ErrNoText is returned when a document contains no readable text
+	ErrNoText = errors.New("no text in document")
+)
+
+// Extract returns the plain text of a text, Markdown or PDF document.
+// The type is taken from the MIME type, falling back to the file name.
+func Extract(fileName, mimeType string, data []byte) (string, error) {
+	var (
+		text string
+		err  error
+	)
+
+	switch kind(fileName, mimeType) {
+	case "pdf":
+		text, err = extractPDF(data)
+	case "markdown":
+		text, err = extractText(data)
+		text = stripMarkdown(text)
+	case "text":
+		text, err = extractText(data)
+	default:
+		return "", ErrUnsupported
+	}
+	if err != nil {
+		return "", err
+	}
+
+	text = normalize(text)
+	if text == "" {
+		return "", ErrNoText
+	}
+	return text, nil
+}
+
+func kind(fileName, mimeType string) string {
+	switch strings.ToLower(path.Ext(fileName)) {
+	case ".pdf":
+		return "pdf"
+	case ".md", ".markdown":
+		return "markdown"
+	case ".txt", ".text":
+		return "text"
+	}
+
+	switch {
+	case mimeType == "application/pdf":
+		return "pdf"
+	case mimeType == "text/markdown":
+		return "markdown"
+	case strings.HasPrefix(mimeType, "text/"):
+		return "text"
+	}
+	return ""
+}
+
+func extractText(data []byte) (string, error) {
+	if !utf8.Valid(data) {
+		return "", ErrUnsupported
+	}
+	return strings.TrimPrefix(string(data), "\uFEFF"), nil
+}
+
+var (
+	mdImage    = regexp.MustCompile(`!\[[^\]]*\]\([^)]*\)`)
+	mdLink     = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	mdHTML     = regexp.MustCompile(`<[^>]+>`)
+	mdEmphasis = regexp.MustCompile("(\\*\\*|__|\\*|_|~~|`)")
+	mdLine     = regexp.MustCompile(`(?m)^\s{0,3}(#{1,6}\s+|>\s?|[-*+]\s+|\d+[.)]\s+)`)
+	mdRule     = regexp.MustCompile(`(?m)^\s*([-*_]\s*){3,}$`)
+	mdFence    = regexp.MustCompile("(?m)^\\s*```.*$")
+)
+
+// stripMarkdown keeps the words of a Markdown text and drops its markup
+func stripMarkdown(s string) string {
+	s = mdFence.ReplaceAllString(s, "")
+	s = mdImage.ReplaceAllString(s, "")
+	s = mdLink.ReplaceAllString(s, "$1")
+	s = mdHTML.ReplaceAllString(s, "")
+	s = mdRule.ReplaceAllString(s, "")
+	s = mdLine.ReplaceAllString(s, "")
+	return mdEmphasis.ReplaceAllString(s, "")
+}
+
+// normalize trims lines and collapses runs of blank lines into paragraph breaks
+func normalize(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+
+	var (
+		b     strings.Builder
+		blank bool
+	)
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" {
+			blank = b.Len() > 0
+			continue
+		}
+		if b.Len() > 0 {
+			if blank {
+				b.WriteString("\n\n")
+			} else {
+				b.WriteString("\n")
+			}
+		}
+		blank = false
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+// Chunk splits text into pieces of at most size bytes, preferring paragraph,
+// then line, then word boundaries so no sentence is cut in the middle of a word.
+func Chunk(text string, size int) []string {
+	var chunks []string
+	for len(text) > size {
+		cut := lastBreak(text[:size], "\n\n")
+		if cut <= 0 {
+			cut = lastBreak(text[:size], "\n")
+		}
+		if cut <= 0 {
+			cut = lastBreak(text[:size], " ")
+		}
+		if cut <= 0 {
+			cut = size
+			for cut > 0 && !utf8.RuneStart(text[cut]) {
+				cut--
+			}
+		}
+
+		chunks = append(chunks, strings.TrimSpace(text[:cut]))
+		text = strings.TrimSpace(text[cut:])
+	}
+	if text != "" {
+		chunks = append(chunks, text)
+	}
+	return chunks
+}
+
+func lastBreak(s, sep string) int {
+	return strings.LastIndex(s, sep)
+}
@@ -0,0 +1,357 @@
+package document
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// extractPDF pulls the text shown by the pages of a PDF, in page order.
+// It understands Flate-compressed streams and object streams, the text
+// operators Tj, TJ, ' and ", and fonts' ToUnicode maps, including the
+// two-byte codes of CID fonts. Text that is mostly not letters, as from
+// fonts with a custom encoding and no ToUnicode map, counts as no text.
+func extractPDF(data []byte) (string, error) {
+	if !bytes.HasPrefix(data, []byte("%PDF")) {
+		return "", ErrUnsupported
+	}
+
+	f := parsePDF(data)
+
+	var b strings.Builder
+	write := func(text string) {
+		if text != "" {
+			b.WriteString(text)
+			b.WriteString("\n\n")
+		}
+	}
+
+	// pages may share content streams, so what is read is capped as a whole
+	budget := maxTotalSize
+	pages := f.pages()
+	for _, page := range pages {
+		var content []byte
+		for _, n := range f.refs(value(page, "Contents")) {
+			if budget -= len(f.streams[n]); budget < 0 {
+				break
+			}
+			content = append(content, f.streams[n]...)
+			content = append(content, '\n')
+		}
+		write(contentText(content, f.fonts(f.resources(page))))
+		if budget < 0 {
+			break
+		}
+	}
+	if len(pages) == 0 {
+		// without a page tree every stream may be page content
+		for _, n := range f.order {
+			write(contentText(f.streams[n], nil))
+		}
+	}
+
+	text := b.String()
+	if !readable(text) {
+		return "", ErrNoText
+	}
+	return text, nil
+}
+
+// readable reports whether letters outnumber the other visible characters,
+// which is not the case for glyph codes shown as if they were text
+func readable(s string) bool {
+	var letters, other int
+	for _, r := range s {
+		switch {
+		case unicode.IsLetter(r):
+			letters++
+		case !unicode.IsSpace(r):
+			other++
+		}
+	}
+	return letters >= other
+}
+
+// contentText interprets the text operators of a content stream,
+// decoding strings with the fonts the stream selects by name
+func contentText(c []byte, fonts map[string]*pdfFont) string {
+	var (
+		b        strings.Builder
+		operands []token // operands seen since the last operator
+		font     *pdfFont
+		inText   bool
+	)
+
+	for i := 0; ; {
+		t, next, ok := readToken(c, i)
+		if !ok {
+			break
+		}
+		i = next
+		if t.kind != opToken {
+			operands = append(operands, t)
+			continue
+		}
+
+		switch t.text {
+		case "BT":
+			inText = true
+		case "ET":
+			inText = false
+			b.WriteString("\n")
+		case "Tf":
+			if len(operands) > 0 && operands[0].kind == nameToken {
+				font = fonts[operands[0].text]
+			}
+		case "Tj", "TJ":
+			if inText {
+				b.WriteString(font.show(operands))
+			}
+		case "'", `"`:
+			if inText {
+				b.WriteString("\n")
+				b.WriteString(font.show(operands))
+			}
+		case "Td", "TD", "T*", "Tm":
+			if inText {
+				b.WriteString(" ")
+			}
+		case "ID":
+			// the binary data of an inline image runs up to EI
+			end := bytes.Index(c[i:], []byte("EI"))
+			if end < 0 {
+				i = len(c)
+			} else {
+				i += end + len("EI")
+			}
+		}
+		operands = operands[:0]
+	}
+	return strings.TrimSpace(b.String())
+}
+
+type tokenKind int
+
+const (
+	opToken tokenKind = iota
+	numberToken
+	stringToken
+	nameToken
+	arrayToken
+	arrayStart
+	arrayEnd
+)
+
+// token is an operator or operand of a content stream or CMap
+type token struct {
+	kind  tokenKind
+	text  string  // an operator or a name
+	str   []byte  // the bytes of a string
+	num   float64 // a number
+	items []token // the items of an array
+}
+
+// readToken reads the token at or after c[i], arrays as a whole,
+// and returns it with the index after it; ok is false at the end
+func readToken(c []byte, i int) (token, int, bool) {
+	t, i, ok := nextToken(c, i)
+	if !ok || t.kind != arrayStart {
+		return t, i, ok
+	}
+
+	// nested arrays don't occur in text operands, so they are flattened
+	arr := token{kind: arrayToken}
+	for depth := 1; ; {
+		var it token
+		it, i, ok = nextToken(c, i)
+		if !ok {
+			break
+		}
+		switch it.kind {
+		case arrayStart:
+			depth++
+			continue
+		case arrayEnd:
+			depth--
+			if depth == 0 {
+				return arr, i, true
+			}
+			continue
+		}
+		arr.items = append(arr.items, it)
+	}
+	return arr, i, true
+}
+
+// nextToken reads the single token at or after c[i]
+func nextToken(c []byte, i int) (token, int, bool) {
+	for i < len(c) {
+		ch := c[i]
+		switch {
+		case ch == '(':
+			s, n := literalString(c[i:])
+			return token{kind: stringToken, str: s}, i + n, true
+		case (ch == '<' || ch == '>') && i+1 < len(c) && c[i+1] == ch:
+			// dictionaries only hold operands that carry no text
+			i += 2
+		case ch == '<':
+			s, n := hexString(c[i:])
+			return token{kind: stringToken, str: s}, i + n, true
+		case ch == '[':
+			return token{kind: arrayStart}, i + 1, true
+		case ch == ']':
+			return token{kind: arrayEnd}, i + 1, true
+		case ch == '/':
+			j := i + 1
+			for j < len(c) && isRegular(c[j]) {
+				j++
+			}
+			return token{kind: nameToken, text: string(c[i+1 : j])}, j, true
+		case ch == '%':
+			for i < len(c) && c[i] != '\n' && c[i] != '\r' {
+				i++
+			}
+		case isRegular(ch):
+			j := i
+			for j < len(c) && isRegular(c[j]) {
+				j++
+			}
+			word := string(c[i:j])
+			if isNumber(word) {
+				if v, err := strconv.ParseFloat(word, 64); err == nil {
+					return token{kind: numberToken, num: v}, j, true
+				}
+			}
+			return token{kind: opToken, text: word}, j, true
+		default:
+			i++
+		}
+	}
+	return token{}, i, false
+}
+
+// literalString reads a "(…)" string, returning its bytes and the bytes consumed
+func literalString(c []byte) ([]byte, int) {
+	var (
+		b     []byte
+		depth = 0
+		i     = 0
+	)
+	for ; i < len(c); i++ {
+		ch := c[i]
+		switch {
+		case ch == '\\' && i+1 < len(c):
+			i++
+			switch e := c[i]; e {
+			case 'n':
+				b = append(b, '\n')
+			case 'r':
+				b = append(b, '\r')
+			case 't':
+				b = append(b, '\t')
+			case 'b', 'f':
+			case '\r', '\n':
+				// line continuation
+			default:
+				if e >= '0' && e <= '7' {
+					v, n := 0, 0
+					for n < 3 && i < len(c) && c[i] >= '0' && c[i] <= '7' {
+						v = v*8 + int(c[i]-'0')
+						i++
+						n++
+					}
+					i--
+					b = append(b, byte(v))
+				} else {
+					b = append(b, e)
+				}
+			}
+		case ch == '(':
+			depth++
+			if depth > 1 {
+				b = append(b, ch)
+			}
+		case ch == ')':
+			depth--
+			if depth == 0 {
+				return b, i + 1
+			}
+			b = append(b, ch)
+		default:
+			b = append(b, ch)
+		}
+	}
+	return b, i
+}
+
+// hexString reads a "<…>" string, returning its bytes and the bytes consumed
+func hexString(c []byte) ([]byte, int) {
+	end := bytes.IndexByte(c, '>')
+	if end < 0 {
+		return nil, len(c)
+	}
+
+	var digits []byte
+	for _, ch := range c[1:end] {
+		if isHex(ch) {
+			digits = append(digits, ch)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+
+	b := make([]byte, 0, len(digits)/2)
+	for i := 0; i < len(digits); i += 2 {
+		b = append(b, unhex(digits[i])<<4|unhex(digits[i+1]))
+	}
+	return b, end + 1
+}
+
+// decodePDFString turns UTF-16BE (with BOM) or single-byte strings into UTF-8
+func decodePDFString(b []byte) string {
+	if len(b) >= 2 && b[0] == 0xFE && b[1] == 0xFF {
+		return utf16String(b[2:])
+	}
+
+	runes := make([]rune, 0, len(b))
+	for _, ch := range b {
+		if ch >= 0x20 || ch == '\n' || ch == '\t' {
+			runes = append(runes, rune(ch))
+		}
+	}
+	return string(runes)
+}
+
+func isRegular(ch byte) bool {
+	switch ch {
+	case ' ', '\t', '\r', '\n', '\f', 0, '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return false
+	}
+	return true
+}
+
+func isNumber(s string) bool {
+	for _, ch := range s {
+		if (ch < '0' || ch > '9') && ch != '.' && ch != '-' && ch != '+' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isHex(ch byte) bool {
+	return ch >= '0' && ch <= '9' || ch >= 'a' && ch <= 'f' || ch >= 'A' && ch <= 'F'
+}
+
+func unhex(ch byte) byte {
+	switch {
+	case ch >= 'a':
+		return ch - 'a' + 10
+	case ch >= 'A':
+		return ch - 'A' + 10
+	default:
+		return ch - '0'
+	}
+}
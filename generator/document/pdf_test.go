@@ -0,0 +1,199 @@
+package document
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func obj(num int, body string) string {
+	return fmt.Sprintf("%d 0 obj\n%s\nendobj\n", num, body)
+}
+
+func stream(dict, data string) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+func deflate(data string) string {
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	_, _ = w.Write([]byte(data))
+	_ = w.Close()
+	return b.String()
+}
+
+// objectStream packs objects, given as number and body, into an object stream
+func objectStream(objects ...any) string {
+	var header, body strings.Builder
+	for i := 0; i+1 < len(objects); i += 2 {
+		fmt.Fprintf(&header, "%d %d ", objects[i], body.Len())
+		body.WriteString(objects[i+1].(string))
+		body.WriteString("\n")
+	}
+	dict := fmt.Sprintf("/Type /ObjStm /N %d /First %d /Filter /FlateDecode", len(objects)/2, header.Len())
+	return stream(dict, deflate(header.String()+body.String()))
+}
+
+func pdf(objects ...string) []byte {
+	return []byte("%PDF-1.7\n" + strings.Join(objects, "") + "trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+}
+
+// onePage is a document whose single page shows content with font /F1, object 5
+func onePage(content string, font ...string) []byte {
+	objects := []string{
+		obj(1, "<< /Type /Catalog /Pages 2 0 R >>"),
+		obj(2, "<< /Type /Pages /Kids [3 0 R] /Count 1 >>"),
+		obj(3, "<< /Type /Page /Parent 2 0 R /Resources << /Font << /F1 5 0 R >> >> /Contents 4 0 R >>"),
+		obj(4, stream("", content)),
+	}
+	return pdf(append(objects, font...)...)
+}
+
+const toUnicode = `/CIDInit /ProcSet findresource begin
+12 dict begin
+begincmap
+1 begincodespacerange
+<0000> <FFFF>
+endcodespacerange
+2 beginbfchar
+<0003> <0020>
+<0010> <00E9>
+endbfchar
+2 beginbfrange
+<0020> <0039> <0061>
+<0040> <0041> [<0048> <0069>]
+endbfrange
+endcmap
+CMapName currentdict /CMap defineresource pop
+end
+end`
+
+func TestExtractPDF(t *testing.T) {
+	helvetica := obj(5, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>")
+	cidFont := "<< /Type /Font /Subtype /Type0 /BaseFont /ABCDEF+Arial /Encoding /Identity-H /DescendantFonts [7 0 R] /ToUnicode 6 0 R >>"
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+		err  error
+	}{
+		{
+			name: "TJ gaps",
+			data: onePage("BT /F1 12 Tf 72 700 Td [(Hel) -20 (lo) -300 (world)] TJ ET", helvetica),
+			want: "Hello world",
+		},
+		{
+			name: "escapes and lines",
+			data: onePage(`BT /F1 12 Tf (\(one\)) Tj T* (two) ' ET`, helvetica),
+			want: "(one)\ntwo",
+		},
+		{
+			name: "page order",
+			data: pdf(
+				obj(1, "<< /Type /Catalog /Pages 2 0 R >>"),
+				obj(2, "<< /Type /Pages /Kids [6 0 R 3 0 R] /Count 2 /Resources << /Font << /F1 5 0 R >> >> >>"),
+				obj(3, "<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>"),
+				obj(4, stream("", "BT /F1 12 Tf (second) Tj ET")),
+				helvetica,
+				obj(6, "<< /Type /Page /Parent 2 0 R /Contents [7 0 R] >>"),
+				obj(7, stream("/Filter /FlateDecode", deflate("BT /F1 12 Tf (first) Tj ET"))),
+			),
+			want: "first\n\nsecond",
+		},
+		{
+			name: "CID font with ToUnicode in an object stream",
+			data: onePage(
+				"BT /F1 12 Tf [<00400041> -500 <0022002000250010>] TJ ET",
+				obj(6, stream("/Filter /FlateDecode", deflate(toUnicode))),
+				obj(8, objectStream(5, cidFont, 7, "<< /Type /Font /Subtype /CIDFontType2 /BaseFont /ABCDEF+Arial >>")),
+			),
+			want: "Hi café",
+		},
+		{
+			name: "CID font without ToUnicode",
+			data: onePage(
+				"BT /F1 12 Tf <0022002000250010> Tj ET",
+				obj(5, "<< /Type /Font /Subtype /Type0 /BaseFont /ABCDEF+Arial /Encoding /Identity-H /DescendantFonts [7 0 R] >>"),
+			),
+			err: ErrNoText,
+		},
+		{
+			name: "glyph codes shown as text",
+			data: onePage(`BT /F1 12 Tf <2223242526272829> Tj (+,-./ 0123) Tj ET`, helvetica),
+			err:  ErrNoText,
+		},
+		{
+			name: "not a PDF",
+			data: []byte("hello"),
+			err:  ErrUnsupported,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Extract("doc.pdf", "application/pdf", tt.data)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error %v, want %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractPDFCycles(t *testing.T) {
+	// the page tree and the page's parent both lead back to themselves
+	data := pdf(
+		obj(1, "<< /Type /Catalog /Pages 2 0 R >>"),
+		obj(2, "<< /Type /Pages /Kids [2 0 R 2 0 R 3 0 R 2 0 R 3 0 R] /Parent 2 0 R >>"),
+		obj(3, "<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>"),
+		obj(4, stream("", "BT (looped) Tj ET")),
+	)
+
+	done := make(chan struct{})
+	var (
+		got string
+		err error
+	)
+	go func() {
+		defer close(done)
+		got, err = Extract("doc.pdf", "application/pdf", data)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("extraction doesn't end")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "looped" {
+		t.Errorf("got %q, want the page once", got)
+	}
+}
+
+func TestParsePDFInflateBudget(t *testing.T) {
+	// each stream inflates to 4 MiB, far more than it takes in the file
+	zeros := deflate(strings.Repeat("\x00", 4<<20))
+	objects := make([]string, 0, 32)
+	for i := 1; i <= cap(objects); i++ {
+		objects = append(objects, obj(i, stream("/Filter /FlateDecode", zeros)))
+	}
+
+	f := parsePDF(pdf(objects...))
+
+	total := 0
+	for _, s := range f.streams {
+		total += len(s)
+	}
+	if total > maxTotalSize {
+		t.Errorf("inflated %d bytes, more than %d", total, maxTotalSize)
+	}
+}
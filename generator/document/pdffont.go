@@ -0,0 +1,200 @@
+package document
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+const (
+	// maxRange caps the codes one bfrange of a CMap may map
+	maxRange = 1 << 16
+	// wordGap is the TJ adjustment, in thousandths of a text unit, from which
+	// the gap between two strings is read as a space between words
+	wordGap = 200
+)
+
+// pdfFont decodes the strings shown with a font
+type pdfFont struct {
+	cmap    *cmap // the ToUnicode map, if the font has one
+	twoByte bool  // a composite font, whose codes default to two bytes
+}
+
+func (f *pdfFont) decode(s []byte) string {
+	switch {
+	case f == nil:
+		return decodePDFString(s)
+	case f.cmap != nil:
+		n := 1
+		if f.twoByte {
+			n = 2
+		}
+		return f.cmap.decode(s, n)
+	case f.twoByte:
+		// the glyph ids of a CID font mean nothing without a ToUnicode map
+		return ""
+	}
+	return decodePDFString(s)
+}
+
+// show returns the text of the operands of a text-showing operator;
+// in TJ arrays a large enough negative adjustment separates two words
+func (f *pdfFont) show(operands []token) string {
+	var b strings.Builder
+	for _, op := range operands {
+		switch op.kind {
+		case stringToken:
+			b.WriteString(f.decode(op.str))
+		case arrayToken:
+			for _, it := range op.items {
+				switch {
+				case it.kind == stringToken:
+					b.WriteString(f.decode(it.str))
+				case it.kind == numberToken && it.num <= -wordGap:
+					b.WriteString(" ")
+				}
+			}
+		}
+	}
+	return b.String()
+}
+
+// cmap is a ToUnicode map from character codes to text
+type cmap struct {
+	spaces []codespace
+	chars  map[string]string
+}
+
+// codespace is a range of codes, whose length gives the bytes per code
+type codespace struct{ lo, hi []byte }
+
+func parseCMap(data []byte) *cmap {
+	m := &cmap{chars: make(map[string]string)}
+
+	var operands []token
+	for i := 0; ; {
+		t, next, ok := readToken(data, i)
+		if !ok {
+			break
+		}
+		i = next
+		if t.kind != opToken {
+			operands = append(operands, t)
+			continue
+		}
+
+		switch t.text {
+		case "endcodespacerange":
+			for j := 0; j+1 < len(operands); j += 2 {
+				lo, hi := operands[j].str, operands[j+1].str
+				if len(lo) > 0 && len(lo) == len(hi) {
+					m.spaces = append(m.spaces, codespace{lo, hi})
+				}
+			}
+		case "endbfchar":
+			for j := 0; j+1 < len(operands); j += 2 {
+				m.chars[string(operands[j].str)] = utf16String(operands[j+1].str)
+			}
+		case "endbfrange":
+			for j := 0; j+2 < len(operands); j += 3 {
+				m.addRange(operands[j].str, operands[j+1].str, operands[j+2])
+			}
+		}
+		operands = operands[:0]
+	}
+
+	if len(m.chars) == 0 {
+		return nil
+	}
+	return m
+}
+
+func (m *cmap) addRange(lo, hi []byte, dst token) {
+	if len(lo) == 0 || len(lo) != len(hi) || len(lo) > 4 {
+		return
+	}
+
+	from, to := codeValue(lo), codeValue(hi)
+	for k := 0; from+k <= to && k < maxRange; k++ {
+		code := codeBytes(from+k, len(lo))
+		switch dst.kind {
+		case arrayToken:
+			if k < len(dst.items) {
+				m.chars[code] = utf16String(dst.items[k].str)
+			}
+		case stringToken:
+			units := utf16Units(dst.str)
+			if len(units) == 0 {
+				return
+			}
+			units[len(units)-1] += uint16(k)
+			m.chars[code] = string(utf16.Decode(units))
+		}
+	}
+}
+
+// decode maps s code by code; n is the code length when no codespace matches
+func (m *cmap) decode(s []byte, n int) string {
+	var b strings.Builder
+	for len(s) > 0 {
+		size := m.codeLen(s, n)
+		if size > len(s) {
+			size = len(s)
+		}
+
+		if text, ok := m.chars[string(s[:size])]; ok {
+			for _, r := range text {
+				if !unicode.IsControl(r) || r == '\n' || r == '\t' {
+					b.WriteRune(r)
+				}
+			}
+		} else if size == 1 {
+			b.WriteString(decodePDFString(s[:1]))
+		}
+		s = s[size:]
+	}
+	return b.String()
+}
+
+func (m *cmap) codeLen(s []byte, n int) int {
+	for _, cs := range m.spaces {
+		size := len(cs.lo)
+		if len(s) >= size && bytes.Compare(s[:size], cs.lo) >= 0 && bytes.Compare(s[:size], cs.hi) <= 0 {
+			return size
+		}
+	}
+	return n
+}
+
+func codeValue(b []byte) int {
+	v := 0
+	for _, ch := range b {
+		v = v<<8 | int(ch)
+	}
+	return v
+}
+
+func codeBytes(v, n int) string {
+	b := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+	return string(b)
+}
+
+func utf16Units(b []byte) []uint16 {
+	if len(b) == 1 {
+		return []uint16{uint16(b[0])}
+	}
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return units
+}
+
+func utf16String(b []byte) string {
+	return string(utf16.Decode(utf16Units(b)))
+}
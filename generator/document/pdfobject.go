@@ -0,0 +1,382 @@
+package document
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxStreamSize caps a single decompressed PDF stream
+	maxStreamSize = 16 << 20
+	// maxTotalSize caps the decompressed streams of a whole document, and
+	// so the page content read from them
+	maxTotalSize = 64 << 20
+	// maxDepth caps how far the page tree and resource inheritance are followed
+	maxDepth = 32
+	// maxPages caps the pages read from a document
+	maxPages = 2000
+)
+
+var (
+	pdfObject  = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+	pdfRef     = regexp.MustCompile(`(\d+)\s+\d+\s+R\b`)
+	pdfRefOnly = regexp.MustCompile(`^(\d+)\s+\d+\s+R\b`)
+	pdfLength  = regexp.MustCompile(`/Length\s+(\d+)(\s+\d+\s+R\b)?`)
+	pdfFontRef = regexp.MustCompile(`/([^\s/<>\[\]()%]+)\s+(\d+)\s+\d+\s+R\b`)
+)
+
+// pdfFile holds the objects of a PDF by number
+type pdfFile struct {
+	objects map[int][]byte   // object bodies; the dictionary for streams
+	streams map[int][]byte   // decoded stream data
+	order   []int            // object numbers in file order
+	cache   map[int]*pdfFont // fonts already read
+	budget  int              // decompressed bytes still allowed
+}
+
+func parsePDF(data []byte) *pdfFile {
+	f := &pdfFile{
+		objects: make(map[int][]byte),
+		streams: make(map[int][]byte),
+		cache:   make(map[int]*pdfFont),
+		budget:  maxTotalSize,
+	}
+
+	for _, loc := range pdfObject.FindAllSubmatchIndex(data, -1) {
+		num, err := strconv.Atoi(string(data[loc[2]:loc[3]]))
+		if err != nil {
+			continue
+		}
+
+		body := data[loc[1]:]
+		end := bytes.Index(body, []byte("endobj"))
+		if s := bytes.Index(body, []byte("stream")); s >= 0 && (end < 0 || s < end) {
+			dict := body[:s]
+			f.add(num, dict)
+			if dec := f.decodeStream(dict, streamData(dict, body[s+len("stream"):])); dec != nil {
+				f.streams[num] = dec
+			}
+			continue
+		}
+		if end < 0 {
+			end = len(body)
+		}
+		f.add(num, body[:end])
+	}
+
+	// PDF 1.5 writers keep most dictionaries, fonts among them, in object streams
+	for _, num := range f.order {
+		if name(value(f.objects[num], "Type")) == "ObjStm" {
+			f.unpack(f.objects[num], f.streams[num])
+		}
+	}
+	return f
+}
+
+func (f *pdfFile) add(num int, body []byte) {
+	if _, ok := f.objects[num]; !ok {
+		f.order = append(f.order, num)
+	}
+	f.objects[num] = body
+}
+
+// unpack adds the objects compressed into an object stream
+func (f *pdfFile) unpack(dict, data []byte) {
+	n, first := intValue(dict, "N"), intValue(dict, "First")
+	if first <= 0 || first > len(data) {
+		return
+	}
+
+	type entry struct{ num, off int }
+	var (
+		entries []entry
+		fields  = strings.Fields(string(data[:first]))
+	)
+	for i := 0; i+1 < len(fields) && len(entries) < n; i += 2 {
+		num, err1 := strconv.Atoi(fields[i])
+		off, err2 := strconv.Atoi(fields[i+1])
+		if err1 != nil || err2 != nil {
+			return
+		}
+		entries = append(entries, entry{num, off})
+	}
+
+	for i, e := range entries {
+		start, end := first+e.off, len(data)
+		if i+1 < len(entries) {
+			end = first + entries[i+1].off
+		}
+		if start < first || start > end || end > len(data) {
+			continue
+		}
+		if _, ok := f.objects[e.num]; !ok {
+			f.add(e.num, data[start:end])
+		}
+	}
+}
+
+// streamData returns the raw bytes of a stream, rest starting after "stream"
+func streamData(dict, rest []byte) []byte {
+	rest = bytes.TrimPrefix(rest, []byte("\r"))
+	rest = bytes.TrimPrefix(rest, []byte("\n"))
+
+	if m := pdfLength.FindSubmatch(dict); m != nil && len(m[2]) == 0 {
+		n, err := strconv.Atoi(string(m[1]))
+		if err == nil && n <= len(rest) &&
+			bytes.HasPrefix(bytes.TrimLeft(rest[n:], " \t\r\n"), []byte("endstream")) {
+			return rest[:n]
+		}
+	}
+	if end := bytes.Index(rest, []byte("endstream")); end >= 0 {
+		return rest[:end]
+	}
+	return rest
+}
+
+func (f *pdfFile) decodeStream(dict, raw []byte) []byte {
+	switch {
+	case bytes.Contains(dict, []byte("/FlateDecode")):
+		if f.budget <= 0 {
+			return nil
+		}
+		dec, err := inflate(raw, min(maxStreamSize, f.budget))
+		if err != nil {
+			return nil
+		}
+		f.budget -= len(dec)
+		return dec
+	case bytes.Contains(dict, []byte("/Filter")):
+		// other filters hold images or fonts, not text
+		return nil
+	}
+	return raw
+}
+
+func inflate(raw []byte, limit int) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = r.Close() }()
+
+	out, err := io.ReadAll(io.LimitReader(r, int64(limit)))
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	return out, nil
+}
+
+// pages returns the page dictionaries in reading order
+func (f *pdfFile) pages() [][]byte {
+	var pages [][]byte
+	for _, num := range f.order {
+		if obj := f.objects[num]; name(value(obj, "Type")) == "Catalog" {
+			if root, ok := ref(value(obj, "Pages")); ok {
+				f.walk(root, &pages, make(map[int]bool), 0)
+			}
+			break
+		}
+	}
+	if len(pages) > 0 {
+		return pages
+	}
+
+	// a broken page tree still leaves the pages themselves
+	for _, num := range f.order {
+		if len(pages) == maxPages {
+			break
+		}
+		if obj := f.objects[num]; name(value(obj, "Type")) == "Page" {
+			pages = append(pages, obj)
+		}
+	}
+	return pages
+}
+
+// walk collects the pages below a node of the page tree. Each node is
+// visited once, so a tree that refers back to itself still ends.
+func (f *pdfFile) walk(num int, pages *[][]byte, seen map[int]bool, depth int) {
+	if seen[num] || depth > maxDepth || len(*pages) == maxPages {
+		return
+	}
+	seen[num] = true
+
+	node := f.dict(f.objects[num])
+	if node == nil {
+		return
+	}
+	if name(value(node, "Type")) == "Page" {
+		*pages = append(*pages, node)
+		return
+	}
+	for _, kid := range f.refs(value(node, "Kids")) {
+		f.walk(kid, pages, seen, depth+1)
+	}
+}
+
+// resources returns the resources of a page, which it may inherit
+func (f *pdfFile) resources(page []byte) []byte {
+	seen := make(map[int]bool)
+	for i := 0; page != nil && i < maxDepth; i++ {
+		if r := f.dict(value(page, "Resources")); r != nil {
+			return r
+		}
+		parent, ok := ref(value(page, "Parent"))
+		if !ok || seen[parent] {
+			return nil
+		}
+		seen[parent] = true
+		page = f.dict(f.objects[parent])
+	}
+	return nil
+}
+
+// fonts returns the fonts of a resource dictionary by name
+func (f *pdfFile) fonts(resources []byte) map[string]*pdfFont {
+	fonts := make(map[string]*pdfFont)
+	for _, m := range pdfFontRef.FindAllSubmatch(f.dict(value(resources, "Font")), -1) {
+		if num, err := strconv.Atoi(string(m[2])); err == nil {
+			fonts[string(m[1])] = f.font(num)
+		}
+	}
+	return fonts
+}
+
+func (f *pdfFile) font(num int) *pdfFont {
+	if font, ok := f.cache[num]; ok {
+		return font
+	}
+
+	obj := f.objects[num]
+	font := &pdfFont{twoByte: name(value(obj, "Subtype")) == "Type0"}
+	if n, ok := ref(value(obj, "ToUnicode")); ok {
+		font.cmap = parseCMap(f.streams[n])
+	}
+	f.cache[num] = font
+	return font
+}
+
+// dict returns the dictionary v holds or refers to
+func (f *pdfFile) dict(v []byte) []byte {
+	if n, ok := ref(v); ok {
+		v = f.objects[n]
+	}
+	v = bytes.TrimLeft(v, " \t\r\n\f\x00")
+	if !bytes.HasPrefix(v, []byte("<<")) {
+		return nil
+	}
+
+	depth := 0
+	for i := 0; i+1 < len(v); i++ {
+		switch {
+		case v[i] == '<' && v[i+1] == '<':
+			depth++
+			i++
+		case v[i] == '>' && v[i+1] == '>':
+			depth--
+			i++
+			if depth == 0 {
+				return v[:i+1]
+			}
+		}
+	}
+	return v
+}
+
+// refs returns the objects referred to by an array, or by a single reference
+func (f *pdfFile) refs(v []byte) []int {
+	if n, ok := ref(v); ok {
+		obj := bytes.TrimLeft(f.objects[n], " \t\r\n\f\x00")
+		if !bytes.HasPrefix(obj, []byte("[")) {
+			return []int{n}
+		}
+		v = obj
+	}
+	if !bytes.HasPrefix(v, []byte("[")) {
+		return nil
+	}
+	end := bytes.IndexByte(v, ']')
+	if end < 0 {
+		return nil
+	}
+
+	var nums []int
+	for _, m := range pdfRef.FindAllSubmatch(v[:end], -1) {
+		if n, err := strconv.Atoi(string(m[1])); err == nil {
+			nums = append(nums, n)
+		}
+	}
+	return nums
+}
+
+// value returns the text after a top-level /key of a dictionary, or nil
+func value(dict []byte, key string) []byte {
+	depth := 0
+	for i := 0; i < len(dict); i++ {
+		switch ch := dict[i]; {
+		case ch == '<' && i+1 < len(dict) && dict[i+1] == '<':
+			depth++
+			i++
+		case ch == '>' && i+1 < len(dict) && dict[i+1] == '>':
+			depth--
+			i++
+		case ch == '[':
+			depth++
+		case ch == ']':
+			depth--
+		case ch == '(':
+			_, n := literalString(dict[i:])
+			i += n - 1
+		case ch == '<':
+			end := bytes.IndexByte(dict[i:], '>')
+			if end < 0 {
+				return nil
+			}
+			i += end
+		case ch == '/':
+			j := i + 1
+			for j < len(dict) && isRegular(dict[j]) {
+				j++
+			}
+			if depth == 1 && string(dict[i+1:j]) == key {
+				return bytes.TrimLeft(dict[j:], " \t\r\n\f\x00")
+			}
+			i = j - 1
+		}
+	}
+	return nil
+}
+
+func name(v []byte) string {
+	if len(v) == 0 || v[0] != '/' {
+		return ""
+	}
+	j := 1
+	for j < len(v) && isRegular(v[j]) {
+		j++
+	}
+	return string(v[1:j])
+}
+
+func ref(v []byte) (int, bool) {
+	m := pdfRefOnly.FindSubmatch(v)
+	if m == nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(string(m[1]))
+	return n, err == nil
+}
+
+func intValue(dict []byte, key string) int {
+	v := value(dict, key)
+	j := 0
+	for j < len(v) && v[j] >= '0' && v[j] <= '9' {
+		j++
+	}
+	n, _ := strconv.Atoi(string(v[:j]))
+	return n
+}
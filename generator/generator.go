@@ -0,0 +1,136 @@
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	MaxCards          = 50
+	maxQuestionLength = 300
+	maxAnswerLength   = 500
+)
+
+var (
+	// ErrBadOutput is returned when the model output doesn't match the expected format
+	ErrBadOutput = errors.New("bad generator output")
+	// ErrNoCards is returned when the model produced no usable cards
+	ErrNoCards = errors.New("no cards generated")
+)
+
+// Provider generates flashcards
+type Provider interface {
+	Generate(ctx context.Context, req Request) ([]Card, error)
+}
+
+// Request describes what to write cards about: a short topic, or a piece of
+// source text such as a chunk of lecture notes.
+type Request struct {
+	Topic string
+	Text  string
+	N     int // number of cards wanted
+}
+
+// Card is a single generated question and answer
+type Card struct {
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+}
+
+const promptFormat = `Reply with JSON only, exactly in this form:
+{"cards": [{"question": "...", "answer": "..."}]}
+Questions and answers must be single lines; answers should be short.`
+
+// Prompt is the instruction sent to language models
+func Prompt(req Request) string {
+	if req.Text != "" {
+		return fmt.Sprintf("Create up to %d flashcards covering the key facts of the text below.\n%s\n\nText:\n%s",
+			req.N, promptFormat, req.Text)
+	}
+	return fmt.Sprintf("Create %d flashcards about the following topic.\n%s\n\nTopic: %s",
+		req.N, promptFormat, req.Topic)
+}
+
+// Merge joins card lists, dropping repeated questions
+func Merge(lists ...[]Card) []Card {
+	seen := make(map[string]bool)
+	var res []Card
+	for _, cards := range lists {
+		for _, c := range cards {
+			key := questionKey(c.Question)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+// questionKey normalises a question for duplicate detection
+func questionKey(q string) string {
+	return strings.ToLower(strings.Join(strings.Fields(strings.TrimRight(q, "?.! ")), " "))
+}
+
+// Parse strictly validates model output and returns at most limit cards.
+// Whitespace inside fields is collapsed, so a card always fits on one line.
+func Parse(raw string, limit int) ([]Card, error) {
+	raw = stripFence(strings.TrimSpace(raw))
+
+	var out struct {
+		Cards []Card `json:"cards"`
+	}
+	dec := json.NewDecoder(strings.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&out); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadOutput, err)
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("%w: trailing data", ErrBadOutput)
+	}
+
+	seen := make(map[string]bool)
+	cards := make([]Card, 0, len(out.Cards))
+	for i, c := range out.Cards {
+		c.Question = strings.Join(strings.Fields(c.Question), " ")
+		c.Answer = strings.Join(strings.Fields(c.Answer), " ")
+
+		switch {
+		case c.Question == "" || c.Answer == "":
+			return nil, fmt.Errorf("%w: card %d is empty", ErrBadOutput, i+1)
+		case len(c.Question) > maxQuestionLength || len(c.Answer) > maxAnswerLength:
+			return nil, fmt.Errorf("%w: card %d is too long", ErrBadOutput, i+1)
+		}
+
+		key := questionKey(c.Question)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		cards = append(cards, c)
+	}
+
+	if len(cards) == 0 {
+		return nil, ErrNoCards
+	}
+	if limit > 0 && len(cards) > limit {
+		cards = cards[:limit]
+	}
+	return cards, nil
+}
+
+// stripFence removes a ```json … ``` block around the output, which models like to add
+func stripFence(s string) string {
+	if !strings.HasPrefix(s, "```") {
+		return s
+	}
+	s = strings.TrimPrefix(s, "```")
+	if i := strings.Index(s, "\n"); i >= 0 {
+		s = s[i+1:]
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "```"))
+}
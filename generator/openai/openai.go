@@ -0,0 +1,114 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"flashcard/generator"
+	"flashcard/lib/e"
+)
+
+const (
+	chatCompletionsPath = "/chat/completions"
+	requestTimeout      = 60 * time.Second
+)
+
+// Client talks to any OpenAI-compatible chat completions API, so a local
+// model server or a mock can stand in by changing the base URL.
+type Client struct {
+	baseURL string
+	apiKey  string
+	model   string
+	client  http.Client
+}
+
+type chatRequest struct {
+	Model          string          `json:"model"`
+	Messages       []chatMessage   `json:"messages"`
+	ResponseFormat *responseFormat `json:"response_format,omitempty"`
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type responseFormat struct {
+	Type string `json:"type"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func New(baseURL, apiKey, model string) *Client {
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  apiKey,
+		model:   model,
+		client:  http.Client{Timeout: requestTimeout},
+	}
+}
+
+func (c *Client) Generate(ctx context.Context, r generator.Request) (cards []generator.Card, err error) {
+	defer func() { err = e.WrapIfErr("can't generate cards", err) }()
+
+	body, err := json.Marshal(chatRequest{
+		Model: c.model,
+		Messages: []chatMessage{
+			{Role: "system", Content: "You write concise flashcards for students."},
+			{Role: "user", Content: generator.Prompt(r)},
+		},
+		ResponseFormat: &responseFormat{Type: "json_object"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+chatCompletionsPath, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var res chatResponse
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, fmt.Errorf("unexpected response (status %d): %w", resp.StatusCode, err)
+	}
+	if res.Error != nil {
+		return nil, fmt.Errorf("api error (status %d): %s", resp.StatusCode, res.Error.Message)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	if len(res.Choices) == 0 {
+		return nil, generator.ErrNoCards
+	}
+
+	return generator.Parse(res.Choices[0].Message.Content, r.N)
+}
@@ -0,0 +1,40 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"flashcard/generator"
+)
+
+// Provider makes placeholder cards without any model, for local development
+type Provider struct{}
+
+func New() Provider {
+	return Provider{}
+}
+
+func (Provider) Generate(_ context.Context, r generator.Request) ([]generator.Card, error) {
+	topic := r.Topic
+	if topic == "" {
+		// name the cards after the start of the text
+		topic = strings.Join(first(strings.Fields(r.Text), 3), " ")
+	}
+
+	cards := make([]generator.Card, 0, r.N)
+	for i := 1; i <= r.N; i++ {
+		cards = append(cards, generator.Card{
+			Question: fmt.Sprintf("%s: question %d", topic, i),
+			Answer:   fmt.Sprintf("%s: answer %d", topic, i),
+		})
+	}
+	return cards, nil
+}
+
+func first(words []string, n int) []string {
+	if len(words) > n {
+		return words[:n]
+	}
+	return words
+}
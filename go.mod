@@ -2,4 +2,4 @@ module flashcard
 
 go 1.23.1
 
-require github.com/mattn/go-sqlite3 v1.14.28 // indirect
+require github.com/mattn/go-sqlite3 v1.14.28
@@ -0,0 +1,19 @@
+package i18n
+
+// PluralForms is pluralForms for the tests of package i18n_test
+var PluralForms = pluralForms
+
+// Lookup returns the raw translation of key in lang, without falling back
+func (c *Catalog) Lookup(lang, key string) (text string, plural map[string]string, ok bool) {
+	m, ok := c.locales[lang][key]
+	return m.text, m.plural, ok
+}
+
+// Keys lists the keys of lang
+func (c *Catalog) Keys(lang string) []string {
+	keys := make([]string, 0, len(c.locales[lang]))
+	for key := range c.locales[lang] {
+		keys = append(keys, key)
+	}
+	return keys
+}
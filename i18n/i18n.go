@@ -0,0 +1,164 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"flashcard/lib/e"
+)
+
+// Fallback is the locale used for users whose language isn't bundled.
+// Every other locale must translate all of its keys.
+const Fallback = "en"
+
+//go:embed locales/*.json
+var files embed.FS
+
+// ErrIncomplete is returned when a locale misses keys or plural forms
+var ErrIncomplete = errors.New("incomplete locale")
+
+// Catalog holds the translations of all bundled locales
+type Catalog struct {
+	locales map[string]map[string]message
+}
+
+// message is a translation: a single format, or one per plural form
+type message struct {
+	text   string
+	plural map[string]string // form ("one", "few", …) → format
+}
+
+func (m *message) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &m.text); err == nil {
+		return nil
+	}
+	return json.Unmarshal(data, &m.plural)
+}
+
+// Load reads the bundled locales and checks that each of them has every key
+// of the fallback locale, with every plural form its language needs.
+func Load() (c *Catalog, err error) {
+	defer func() { err = e.WrapIfErr("can't load locales", err) }()
+
+	entries, err := files.ReadDir("locales")
+	if err != nil {
+		return nil, err
+	}
+
+	c = &Catalog{locales: make(map[string]map[string]message)}
+	for _, entry := range entries {
+		data, err := files.ReadFile(path.Join("locales", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var msgs map[string]message
+		if err := json.Unmarshal(data, &msgs); err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		c.locales[strings.TrimSuffix(entry.Name(), ".json")] = msgs
+	}
+
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// check reports the first missing key or plural form, and keys no other
+// locale knows about, which usually are typos
+func (c *Catalog) check() error {
+	base, ok := c.locales[Fallback]
+	if !ok {
+		return fmt.Errorf("%w: no %s locale", ErrIncomplete, Fallback)
+	}
+
+	for _, lang := range c.Locales() {
+		msgs := c.locales[lang]
+		for key := range base {
+			m, ok := msgs[key]
+			if !ok {
+				return fmt.Errorf("%w: %s has no %q", ErrIncomplete, lang, key)
+			}
+			if m.plural == nil {
+				continue
+			}
+			for _, form := range pluralForms(lang) {
+				if _, ok := m.plural[form]; !ok {
+					return fmt.Errorf("%w: %s %q has no %q form", ErrIncomplete, lang, key, form)
+				}
+			}
+		}
+		for key := range msgs {
+			if _, ok := base[key]; !ok {
+				return fmt.Errorf("%w: %s has unknown %q", ErrIncomplete, lang, key)
+			}
+		}
+	}
+	return nil
+}
+
+// Locales lists the bundled locales, fallback first
+func (c *Catalog) Locales() []string {
+	res := make([]string, 0, len(c.locales))
+	for lang := range c.locales {
+		if lang != Fallback {
+			res = append(res, lang)
+		}
+	}
+	sort.Strings(res)
+	return append([]string{Fallback}, res...)
+}
+
+// Has reports whether lang is bundled
+func (c *Catalog) Has(lang string) bool {
+	_, ok := c.locales[lang]
+	return ok
+}
+
+// Match picks the bundled locale for a Telegram language_code such as "pt-br"
+func (c *Catalog) Match(code string) string {
+	code = strings.ToLower(code)
+	if c.Has(code) {
+		return code
+	}
+	if base, _, ok := strings.Cut(code, "-"); ok && c.Has(base) {
+		return base
+	}
+	return Fallback
+}
+
+// Text formats the message key in lang. A plural message picks its form by
+// the first integer among args, so "%d card(s)" needs no special call.
+func (c *Catalog) Text(lang, key string, args ...any) string {
+	m, ok := c.locales[lang][key]
+	if !ok {
+		lang = Fallback
+		if m, ok = c.locales[lang][key]; !ok {
+			// better a key in the chat than a crash
+			return key
+		}
+	}
+
+	format := m.text
+	if m.plural != nil {
+		format = m.plural[pluralForm(lang, firstInt(args))]
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+func firstInt(args []any) int {
+	for _, a := range args {
+		if n, ok := a.(int); ok {
+			return n
+		}
+	}
+	return 0
+}
@@ -0,0 +1,94 @@
+package i18n_test
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+	"testing"
+
+	"flashcard/events/telegram"
+	"flashcard/i18n"
+)
+
+// messageKeys reads the values of the msg* constants of the bot's messages
+func messageKeys(t *testing.T) []string {
+	t.Helper()
+
+	f, err := parser.ParseFile(token.NewFileSet(), "../events/telegram/messages.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var keys []string
+	ast.Inspect(f, func(n ast.Node) bool {
+		spec, ok := n.(*ast.ValueSpec)
+		if !ok {
+			return true
+		}
+		for i, name := range spec.Names {
+			if !strings.HasPrefix(name.Name, "msg") || i >= len(spec.Values) {
+				continue
+			}
+			lit, ok := spec.Values[i].(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				t.Errorf("%s isn't a string literal", name.Name)
+				continue
+			}
+			key, err := strconv.Unquote(lit.Value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			keys = append(keys, key)
+		}
+		return false
+	})
+	if len(keys) == 0 {
+		t.Fatal("no message keys found")
+	}
+	return keys
+}
+
+func TestEveryKeyInEveryLocale(t *testing.T) {
+	c, err := i18n.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := append(messageKeys(t), telegram.CommandKeys()...)
+	for _, lang := range c.Locales() {
+		for _, key := range keys {
+			text, plural, ok := c.Lookup(lang, key)
+			switch {
+			case !ok:
+				t.Errorf("%s has no %q", lang, key)
+			case plural == nil && text == "":
+				t.Errorf("%s %q is empty", lang, key)
+			case plural != nil:
+				for _, form := range i18n.PluralForms(lang) {
+					if plural[form] == "" {
+						t.Errorf("%s %q has no %q form", lang, key, form)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestNoUnusedKeys(t *testing.T) {
+	c, err := i18n.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	used := make(map[string]bool)
+	for _, key := range append(messageKeys(t), telegram.CommandKeys()...) {
+		used[key] = true
+	}
+	for _, key := range c.Keys(i18n.Fallback) {
+		if !used[key] {
+			t.Errorf("%q isn't used by the bot", key)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package i18n
+
+// pluralForm is the CLDR plural category of n in lang
+func pluralForm(lang string, n int) string {
+	if n < 0 {
+		n = -n
+	}
+
+	switch lang {
+	case "ru", "uk":
+		switch {
+		case n%10 == 1 && n%100 != 11:
+			return "one"
+		case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+			return "few"
+		default:
+			return "many"
+		}
+	default:
+		if n == 1 {
+			return "one"
+		}
+		return "other"
+	}
+}
+
+// pluralForms lists the categories pluralForm may return for lang
+func pluralForms(lang string) []string {
+	switch lang {
+	case "ru", "uk":
+		return []string{"one", "few", "many"}
+	default:
+		return []string{"one", "other"}
+	}
+}
@@ -0,0 +1,63 @@
+// Package health serves liveness and readiness probes for a process
+// supervisor.
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// checkTimeout bounds all checks of one probe
+const checkTimeout = 5 * time.Second
+
+// Check reports why something isn't healthy, or nil if it is
+type Check func(ctx context.Context) error
+
+// Handler runs all checks and answers 200 if they pass and 503 otherwise,
+// with a line per check
+func Handler(checks map[string]Check) http.Handler {
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+		defer cancel()
+
+		var b strings.Builder
+		status := http.StatusOK
+		for _, name := range names {
+			if err := checks[name](ctx); err != nil {
+				status = http.StatusServiceUnavailable
+				fmt.Fprintf(&b, "%s: %s\n", name, err)
+				continue
+			}
+			fmt.Fprintf(&b, "%s: ok\n", name)
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(b.String()))
+	})
+}
+
+// Recent checks that last() is no older than maxAge; what names the event
+// in the error, e.g. "last fetch"
+func Recent(what string, maxAge time.Duration, last func() time.Time) Check {
+	return func(context.Context) error {
+		t := last()
+		if t.IsZero() {
+			return fmt.Errorf("no %s yet", what)
+		}
+		if age := time.Since(t); age > maxAge {
+			return fmt.Errorf("%s was %s ago", what, age.Round(time.Second))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,50 @@
+// Package logging sets up the bot's structured logger.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+)
+
+// content is text written by users, e.g. a message or a card
+type content string
+
+// Content marks a user's text so the logger can leave it out
+func Content(key, text string) slog.Attr {
+	return slog.Any(key, content(text))
+}
+
+// New creates a logger writing records of at least level to w, as JSON
+// or as key=value text. Content attributes are redacted unless showContent.
+func New(w io.Writer, level slog.Level, json, showContent bool) *slog.Logger {
+	opts := &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			c, ok := a.Value.Any().(content)
+			if !ok {
+				return a
+			}
+			if showContent {
+				return slog.String(a.Key, string(c))
+			}
+			return slog.String(a.Key, fmt.Sprintf("[%d chars]", utf8.RuneCountInString(string(c))))
+		},
+	}
+
+	if json {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+// ParseLevel reads debug, info, warn or error
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.ToUpper(s))); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", s)
+	}
+	return level, nil
+}
@@ -3,58 +3,319 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+	_ "time/tzdata"
 
 	tgClient "flashcard/clients/telegram"
+	"flashcard/events/middleware"
 	"flashcard/events/telegram"
+	"flashcard/storage/blob"
 	"flashcard/storage/sqlite"
 
 	eventconsumer "flashcard/consumer/event-consumer"
+	"flashcard/generator"
+	"flashcard/generator/openai"
+	"flashcard/generator/stub"
+	"flashcard/i18n"
+	"flashcard/lib/health"
+	"flashcard/lib/logging"
+	"flashcard/lib/metrics"
+	"flashcard/scheduler/reminder"
+	"flashcard/storage"
 )
 
 const (
 	tgBotHost         = "api.telegram.org"
 	sqliteStoragePath = "data/sqlite/storage.db"
 	batchSize         = 100
+	reminderInterval  = time.Minute
+	slowEvent         = time.Second // events processed slower than this are logged
+	userRateLimit     = 30          // events per user and rateLimitWindow
+	rateLimitWindow   = time.Minute
+
+	// beyond a long poll: how old the last fetch may be for /readyz and
+	// the last beat of the consumer loop between events for /healthz
+	fetchSlack = time.Minute
+	stuckSlack = 5 * time.Minute
+
+	// how long one attempt at an event may take before /healthz fails:
+	// waiting for the generator plus the Telegram calls around it
+	maxEventTime = telegram.MaxGenerationTime + stuckSlack
 )
 
+type config struct {
+	token          string
+	dialogTimeout  time.Duration
+	generator      string
+	generatorURL   string
+	generatorModel string
+	generatorKey   string
+	blobDir        string
+	pollTimeout    time.Duration
+	deadLetters    bool // list the dead letters and exit
+	replay         int  // replay the dead letter of this update and exit
+	httpAddr       string
+	logLevel       slog.Level
+	logJSON        bool
+	logContent     bool // log what users write, redacted otherwise
+}
+
 func main() {
+	cfg := mustConfig()
+
+	// the log package writes through the same handler
+	slog.SetDefault(logging.New(os.Stderr, cfg.logLevel, cfg.logJSON, cfg.logContent))
+
 	// s := files.New(storagePath)
 	s, err := sqlite.New(sqliteStoragePath)
 	if err != nil {
-		log.Fatal("can't connect to storage: ", err)
+		fatal("can't connect to storage", err)
 	}
 
 	if err := s.Init(context.TODO()); err != nil {
-		log.Fatal("can't init storage: ", err)
+		fatal("can't init storage", err)
+	}
+
+	if cfg.deadLetters {
+		if err := printDeadLetters(s); err != nil {
+			fatal("can't list dead letters", err)
+		}
+		return
 	}
 
+	catalog, err := i18n.Load()
+	if err != nil {
+		fatal("can't load translations", err)
+	}
+
+	tg := tgClient.New(tgBotHost, cfg.token, cfg.pollTimeout)
+
 	eventsProcessor := telegram.New(
-		tgClient.New(tgBotHost, mustToken()),
+		tg,
 		s,
+		cfg.dialogTimeout,
+		mustGenerator(cfg),
+		blobStore(cfg),
+		catalog,
 	)
 
-	log.Print("service started")
+	if cfg.replay != 0 {
+		if err := eventsProcessor.Replay(cfg.replay); err != nil {
+			fatal("can't replay update", err)
+		}
+		slog.Info("update replayed", "update", cfg.replay)
+		return
+	}
+
+	// the menu is a convenience, the bot works without it
+	if err := eventsProcessor.RegisterCommands(); err != nil {
+		slog.Warn("can't register commands", "error", err)
+	}
+
+	reminders := reminder.New(s, tg, eventsProcessor, eventsProcessor, reminderInterval)
+	go func() {
+		if err := reminders.Start(); err != nil {
+			slog.Error("reminders are stopped", "error", err)
+		}
+	}()
 
-	consumer := eventconsumer.New(eventsProcessor, eventsProcessor, batchSize)
+	slog.Info("service started")
+
+	processor := middleware.Chain(eventsProcessor,
+		middleware.Metrics(),
+		middleware.Recover(eventsProcessor.ReportFailure),
+		middleware.Logging(telegram.LogAttrs),
+		middleware.Timing(slowEvent),
+		middleware.RateLimit(userRateLimit, rateLimitWindow, telegram.SenderKey),
+	)
+
+	consumer := eventconsumer.New(eventsProcessor, processor, eventsProcessor, batchSize)
+
+	if cfg.httpAddr != "" {
+		go serveHTTP(cfg.httpAddr,
+			map[string]health.Check{
+				"consumer": func(context.Context) error {
+					return consumer.Stuck(cfg.pollTimeout+stuckSlack, maxEventTime)
+				},
+			},
+			map[string]health.Check{
+				"sqlite":   s.Ping,
+				"telegram": health.Recent("successful fetch", cfg.pollTimeout+fetchSlack, consumer.LastFetch),
+			},
+		)
+	}
 
 	if err := consumer.Start(); err != nil {
-		log.Fatal("service is stopped", err)
+		fatal("service is stopped", err)
 	}
 }
 
-func mustToken() string {
+func mustConfig() config {
 	token := flag.String(
 		"tg-bot-token",
 		"",
 		"token for access to telegram bot",
 	)
+	dialogTimeout := flag.Duration(
+		"dialog-timeout",
+		5*time.Minute,
+		"idle time after which an unanswered dialog is cancelled (0 disables)",
+	)
+
+	gen := flag.String(
+		"generator",
+		"none",
+		"card generator: none, openai (any OpenAI-compatible API) or stub",
+	)
+	generatorURL := flag.String(
+		"generator-url",
+		"https://api.openai.com/v1",
+		"base URL of the OpenAI-compatible API",
+	)
+	generatorModel := flag.String(
+		"generator-model",
+		"gpt-4o-mini",
+		"model used to generate cards",
+	)
+
+	blobDir := flag.String(
+		"blob-dir",
+		"",
+		"directory for local copies of card images and recordings (empty disables)",
+	)
+
+	pollTimeout := flag.Duration(
+		"poll-timeout",
+		30*time.Second,
+		"how long a request for updates waits for new messages",
+	)
+
+	httpAddr := flag.String(
+		"http-addr",
+		"",
+		"address to serve /metrics, /healthz and /readyz on, e.g. :9100 (empty disables)",
+	)
+
+	logLevel := flag.String(
+		"log-level",
+		"info",
+		"least important log records written: debug, info, warn or error",
+	)
+	logJSON := flag.Bool(
+		"log-json",
+		false,
+		"write logs as JSON instead of key=value text",
+	)
+	logContent := flag.Bool(
+		"log-content",
+		false,
+		"log the text of messages and cards, which is redacted by default",
+	)
+
+	deadLetters := flag.Bool(
+		"dead-letters",
+		false,
+		"list the updates that failed to process and exit",
+	)
+	replay := flag.Int(
+		"replay",
+		0,
+		"process the failed update with this id again and exit",
+	)
 
 	flag.Parse()
 
-	if *token == "" {
+	// listing only reads the database
+	if *token == "" && !*deadLetters {
 		log.Fatal("token is not specified")
 	}
 
-	return *token
+	// Telegram counts the timeout in whole seconds, zero means short polling
+	if *pollTimeout < time.Second {
+		log.Fatal("poll timeout must be at least 1s")
+	}
+
+	level, err := logging.ParseLevel(*logLevel)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return config{
+		token:          *token,
+		dialogTimeout:  *dialogTimeout,
+		generator:      *gen,
+		generatorURL:   *generatorURL,
+		generatorModel: *generatorModel,
+		// keep the key out of the process list
+		generatorKey: os.Getenv("OPENAI_API_KEY"),
+		blobDir:      *blobDir,
+		pollTimeout:  *pollTimeout,
+		deadLetters:  *deadLetters,
+		replay:       *replay,
+		httpAddr:     *httpAddr,
+		logLevel:     level,
+		logJSON:      *logJSON,
+		logContent:   *logContent,
+	}
+}
+
+func mustGenerator(cfg config) generator.Provider {
+	switch cfg.generator {
+	case "none", "":
+		return nil
+	case "openai":
+		return openai.New(cfg.generatorURL, cfg.generatorKey, cfg.generatorModel)
+	case "stub":
+		return stub.New()
+	default:
+		fatal("can't create generator", fmt.Errorf("unknown generator %q", cfg.generator))
+		return nil
+	}
+}
+
+func blobStore(cfg config) *blob.Store {
+	if cfg.blobDir == "" {
+		return nil
+	}
+	return blob.New(cfg.blobDir)
+}
+
+func printDeadLetters(s storage.Storage) error {
+	letters, err := s.DeadLetters(context.TODO())
+	if err != nil {
+		return err
+	}
+	if len(letters) == 0 {
+		fmt.Println("no dead letters")
+		return nil
+	}
+	for _, dl := range letters {
+		fmt.Printf("update %d, failed %s after %d attempt(s): %s\n%s\n\n",
+			dl.UpdateID, dl.FailedAt.Format(time.DateTime), dl.Attempts, dl.Reason, dl.Raw)
+	}
+	return nil
+}
+
+// serveHTTP serves metrics and the probes: /healthz fails if the bot must be
+// restarted, /readyz while it can't serve users
+func serveHTTP(addr string, liveness, readiness map[string]health.Check) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Default)
+	mux.Handle("/healthz", health.Handler(liveness))
+	mux.Handle("/readyz", health.Handler(readiness))
+
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		slog.Error("http server is stopped", "error", err)
+	}
+}
+
+// fatal logs err and stops the bot
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
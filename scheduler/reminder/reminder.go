@@ -0,0 +1,101 @@
+package reminder
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"flashcard/lib/e"
+	"flashcard/storage"
+)
+
+// Notifier sends a text message to a chat
+type Notifier interface {
+	SendMessage(chatID int, text string) error
+}
+
+// DueCounter reports how many cards a user has due
+type DueCounter interface {
+	DueCount(ctx context.Context, user string) (int, error)
+}
+
+// Texts words the reminder in the language of the chat
+type Texts interface {
+	ReminderText(ctx context.Context, chatID, due int) string
+}
+
+// Scheduler sends daily reminders to users with due cards
+type Scheduler struct {
+	storage  storage.Storage
+	notifier Notifier
+	due      DueCounter
+	texts    Texts
+	interval time.Duration
+}
+
+func New(storage storage.Storage, notifier Notifier, due DueCounter, texts Texts, interval time.Duration) Scheduler {
+	return Scheduler{
+		storage:  storage,
+		notifier: notifier,
+		due:      due,
+		texts:    texts,
+		interval: interval,
+	}
+}
+
+// Start checks the reminders every interval. The date of the last reminder
+// is stored, so a restart neither repeats nor skips a day's reminder.
+func (s Scheduler) Start() error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.tick(time.Now()); err != nil {
+			slog.Error("scheduler failed", "error", err)
+		}
+		<-ticker.C
+	}
+}
+
+func (s Scheduler) tick(now time.Time) error {
+	ctx := context.Background()
+
+	reminders, err := s.storage.Reminders(ctx)
+	if err != nil {
+		return e.Wrap("can't get reminders", err)
+	}
+
+	for _, r := range reminders {
+		if err := s.remind(ctx, r, now); err != nil {
+			slog.Warn("can't remind", "user", r.UserName, "chat", r.ChatID, "error", err)
+		}
+	}
+
+	return nil
+}
+
+func (s Scheduler) remind(ctx context.Context, r storage.Reminder, now time.Time) error {
+	loc, err := time.LoadLocation(r.TimeZone)
+	if err != nil {
+		return e.Wrap("can't load time zone", err)
+	}
+
+	local := now.In(loc)
+	today := local.Format(storage.DayLayout)
+	if r.LastSent == today || local.Hour()*60+local.Minute() < r.Minute {
+		return nil
+	}
+
+	n, err := s.due.DueCount(ctx, r.UserName)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		if err := s.notifier.SendMessage(r.ChatID, s.texts.ReminderText(ctx, r.ChatID, n)); err != nil {
+			return err
+		}
+	}
+
+	// mark the day as handled even without due cards, so it isn't checked again
+	return s.storage.MarkReminded(ctx, r.UserName, today)
+}
@@ -0,0 +1,5 @@
+package scheduler
+
+type Scheduler interface {
+	Start() error
+}
@@ -0,0 +1,66 @@
+package blob
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"flashcard/lib/e"
+)
+
+// ErrBadKey is returned for keys that can't be used as a file name
+var ErrBadKey = errors.New("bad blob key")
+
+const (
+	dirPerm  = 0o755
+	filePerm = 0o644
+)
+
+// Store keeps binary files, such as card images, in a local directory
+// so they survive even if Telegram forgets them.
+type Store struct {
+	basePath string
+}
+
+func New(basePath string) *Store {
+	return &Store{basePath: basePath}
+}
+
+// Save writes data under key, replacing any previous copy
+func (s *Store) Save(key string, data []byte) (err error) {
+	defer func() { err = e.WrapIfErr("can't save blob", err) }()
+
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.basePath, dirPerm); err != nil {
+		return err
+	}
+
+	// write to a temporary file first so a crash never leaves half a blob
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, filePerm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Load reads the data saved under key
+func (s *Store) Load(key string) (data []byte, err error) {
+	defer func() { err = e.WrapIfErr("can't load blob", err) }()
+
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+func (s *Store) path(key string) (string, error) {
+	if key == "" || strings.ContainsAny(key, `/\`) || key == "." || key == ".." {
+		return "", ErrBadKey
+	}
+	return filepath.Join(s.basePath, key), nil
+}
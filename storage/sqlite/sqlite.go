@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 
@@ -25,6 +26,15 @@ func New(path string) (*Storage, error) {
 	return &Storage{db: db}, nil
 }
 
+// Ping checks that the database file can still be read
+func (s *Storage) Ping(ctx context.Context) error {
+	var tables int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master`).Scan(&tables); err != nil {
+		return fmt.Errorf("can't reach database: %w", err)
+	}
+	return nil
+}
+
 func (s *Storage) Init(ctx context.Context) error {
 	q := `CREATE TABLE IF NOT EXISTS items (
         hash TEXT PRIMARY KEY,
@@ -35,6 +45,183 @@ func (s *Storage) Init(ctx context.Context) error {
 	if _, err := s.db.ExecContext(ctx, q); err != nil {
 		return fmt.Errorf("can't create table: %w", err)
 	}
+	if err := s.addColumn(ctx, "items", "direction", "TEXT NOT NULL DEFAULT 'forward'"); err != nil {
+		return err
+	}
+	if err := s.addColumn(ctx, "items", "visibility", "TEXT NOT NULL DEFAULT 'private'"); err != nil {
+		return err
+	}
+
+	q = `CREATE TABLE IF NOT EXISTS review_log (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        user_name TEXT,
+        name TEXT,
+        card TEXT,
+        correct INTEGER,
+        reviewed_at INTEGER
+    )`
+	if _, err := s.db.ExecContext(ctx, q); err != nil {
+		return fmt.Errorf("can't create table: %w", err)
+	}
+	q = `CREATE INDEX IF NOT EXISTS review_log_user ON review_log (user_name, reviewed_at)`
+	if _, err := s.db.ExecContext(ctx, q); err != nil {
+		return fmt.Errorf("can't create index: %w", err)
+	}
+
+	q = `CREATE TABLE IF NOT EXISTS reminders (
+        user_name TEXT PRIMARY KEY,
+        chat_id INTEGER,
+        minute INTEGER,
+        time_zone TEXT,
+        last_sent TEXT NOT NULL DEFAULT ''
+    )`
+	if _, err := s.db.ExecContext(ctx, q); err != nil {
+		return fmt.Errorf("can't create table: %w", err)
+	}
+
+	q = `CREATE TABLE IF NOT EXISTS shares (
+        code TEXT PRIMARY KEY,
+        owner TEXT,
+        name TEXT,
+        UNIQUE (owner, name)
+    )`
+	if _, err := s.db.ExecContext(ctx, q); err != nil {
+		return fmt.Errorf("can't create table: %w", err)
+	}
+
+	q = `CREATE TABLE IF NOT EXISTS subscriptions (
+        user_name TEXT,
+        name TEXT,
+        owner TEXT,
+        deck TEXT,
+        PRIMARY KEY (user_name, name)
+    )`
+	if _, err := s.db.ExecContext(ctx, q); err != nil {
+		return fmt.Errorf("can't create table: %w", err)
+	}
+	if err := s.addColumn(ctx, "subscriptions", "chat_id", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	if err := s.addColumn(ctx, "shares", "author", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	// scores are per Telegram user; the name is only shown
+	q = `CREATE TABLE IF NOT EXISTS player_scores (
+        chat_id INTEGER,
+        user_id INTEGER,
+        user_name TEXT,
+        points INTEGER,
+        PRIMARY KEY (chat_id, user_id)
+    )`
+	if _, err := s.db.ExecContext(ctx, q); err != nil {
+		return fmt.Errorf("can't create table: %w", err)
+	}
+	if err := s.migrateScores(ctx); err != nil {
+		return err
+	}
+
+	// languages are per Telegram user, whatever chat they write in
+	q = `CREATE TABLE IF NOT EXISTS languages (
+        user_id INTEGER PRIMARY KEY,
+        language TEXT
+    )`
+	if _, err := s.db.ExecContext(ctx, q); err != nil {
+		return fmt.Errorf("can't create table: %w", err)
+	}
+
+	q = `CREATE TABLE IF NOT EXISTS handled_updates (
+        update_id INTEGER PRIMARY KEY,
+        handled_at INTEGER
+    )`
+	if _, err := s.db.ExecContext(ctx, q); err != nil {
+		return fmt.Errorf("can't create table: %w", err)
+	}
+
+	q = `CREATE TABLE IF NOT EXISTS dead_letters (
+        update_id INTEGER PRIMARY KEY,
+        raw BLOB,
+        reason TEXT,
+        attempts INTEGER,
+        failed_at INTEGER
+    )`
+	if _, err := s.db.ExecContext(ctx, q); err != nil {
+		return fmt.Errorf("can't create table: %w", err)
+	}
+	return nil
+}
+
+// migrateScores moves the scores older versions kept by user name. Their
+// users are unknown, so they get negative ids until AddPoint merges them
+// into the score of the next player with that name.
+func (s *Storage) migrateScores(ctx context.Context) (err error) {
+	var n int
+	q := `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'scores'`
+	if err := s.db.QueryRowContext(ctx, q).Scan(&n); err != nil {
+		return fmt.Errorf("can't look for old scores: %w", err)
+	}
+	if n == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("can't migrate scores: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	q = `INSERT INTO player_scores (chat_id, user_id, user_name, points)
+        SELECT chat_id, -rowid, user_name, points FROM scores`
+	if _, err := tx.ExecContext(ctx, q); err != nil {
+		return fmt.Errorf("can't migrate scores: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DROP TABLE scores`); err != nil {
+		return fmt.Errorf("can't migrate scores: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("can't migrate scores: %w", err)
+	}
+	return nil
+}
+
+// addColumn adds a column to an existing table unless it is already present,
+// so databases created by older versions keep working.
+func (s *Storage) addColumn(ctx context.Context, table, column, def string) error {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("can't read table info: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			typ       string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dfltValue, &pk); err != nil {
+			return fmt.Errorf("can't scan table info: %w", err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("can't read table info: %w", err)
+	}
+
+	q := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, def)
+	if _, err := s.db.ExecContext(ctx, q); err != nil {
+		return fmt.Errorf("can't add column %s: %w", column, err)
+	}
 	return nil
 }
 
@@ -43,24 +230,46 @@ func (s *Storage) Save(ctx context.Context, it *storage.Item) error {
 	if err != nil {
 		return err
 	}
-	q := `INSERT INTO items (hash, user_name, name, content) VALUES (?, ?, ?, ?)`
-	if _, err := s.db.ExecContext(ctx, q, h, it.UserName, it.Name, it.Content); err != nil {
+	q := `INSERT INTO items (hash, user_name, name, content, direction, visibility) VALUES (?, ?, ?, ?, ?, ?)`
+	if _, err := s.db.ExecContext(ctx, q, h, it.UserName, it.Name, it.Content, direction(it), visibility(it)); err != nil {
 		return fmt.Errorf("can't save item: %w", err)
 	}
 	return nil
 }
 
 func (s *Storage) Get(ctx context.Context, userName, name string) (*storage.Item, error) {
-	q := `SELECT content FROM items WHERE user_name = ? AND name = ? LIMIT 1`
-	var content string
-	err := s.db.QueryRowContext(ctx, q, userName, name).Scan(&content)
+	q := `SELECT content, direction, visibility FROM items WHERE user_name = ? AND name = ? LIMIT 1`
+	var content, dir, vis string
+	err := s.db.QueryRowContext(ctx, q, userName, name).Scan(&content, &dir, &vis)
 	if err == sql.ErrNoRows {
 		return nil, storage.ErrNoSavedItems
 	}
 	if err != nil {
 		return nil, fmt.Errorf("can't get item: %w", err)
 	}
-	return &storage.Item{UserName: userName, Name: name, Content: content}, nil
+	return &storage.Item{
+		UserName:   userName,
+		Name:       name,
+		Content:    content,
+		Direction:  storage.Direction(dir),
+		Visibility: storage.Visibility(vis),
+	}, nil
+}
+
+func (s *Storage) Update(ctx context.Context, it *storage.Item) error {
+	q := `UPDATE items SET content = ?, direction = ?, visibility = ? WHERE user_name = ? AND name = ?`
+	res, err := s.db.ExecContext(ctx, q, it.Content, direction(it), visibility(it), it.UserName, it.Name)
+	if err != nil {
+		return fmt.Errorf("can't update item: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("can't update item: %w", err)
+	}
+	if n == 0 {
+		return storage.ErrNoSavedItems
+	}
+	return nil
 }
 
 func (s *Storage) IsExists(ctx context.Context, it *storage.Item) (bool, error) {
@@ -72,14 +281,101 @@ func (s *Storage) IsExists(ctx context.Context, it *storage.Item) (bool, error)
 	return count > 0, nil
 }
 
-func (s *Storage) Remove(ctx context.Context, it *storage.Item) error {
+func (s *Storage) Remove(ctx context.Context, it *storage.Item) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("can't remove item: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
 	q := `DELETE FROM items WHERE user_name = ? AND name = ?`
-	if _, err := s.db.ExecContext(ctx, q, it.UserName, it.Name); err != nil {
+	if _, err := tx.ExecContext(ctx, q, it.UserName, it.Name); err != nil {
+		return fmt.Errorf("can't remove item: %w", err)
+	}
+	q = `DELETE FROM review_log WHERE user_name = ? AND name = ?`
+	if _, err := tx.ExecContext(ctx, q, it.UserName, it.Name); err != nil {
+		return fmt.Errorf("can't remove reviews: %w", err)
+	}
+	q = `DELETE FROM shares WHERE owner = ? AND name = ?`
+	if _, err := tx.ExecContext(ctx, q, it.UserName, it.Name); err != nil {
+		return fmt.Errorf("can't remove shares: %w", err)
+	}
+	q = `DELETE FROM subscriptions WHERE owner = ? AND deck = ?`
+	if _, err := tx.ExecContext(ctx, q, it.UserName, it.Name); err != nil {
+		return fmt.Errorf("can't remove subscriptions: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("can't remove item: %w", err)
 	}
 	return nil
 }
 
+func (s *Storage) RemoveReviews(ctx context.Context, userName, name string) error {
+	q := `DELETE FROM review_log WHERE user_name = ? AND name = ?`
+	if _, err := s.db.ExecContext(ctx, q, userName, name); err != nil {
+		return fmt.Errorf("can't remove reviews: %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) AddReview(ctx context.Context, r *storage.Review) error {
+	q := `INSERT INTO review_log (user_name, name, card, correct, reviewed_at) VALUES (?, ?, ?, ?, ?)`
+	if _, err := s.db.ExecContext(ctx, q, r.UserName, r.Name, r.Card, r.Correct, r.At.Unix()); err != nil {
+		return fmt.Errorf("can't add review: %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) Reviews(ctx context.Context, userName string, since time.Time) ([]storage.Review, error) {
+	q := `SELECT name, card, correct, reviewed_at FROM review_log
+        WHERE user_name = ? AND reviewed_at >= ? ORDER BY reviewed_at, id`
+	rows, err := s.db.QueryContext(ctx, q, userName, since.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("can't list reviews: %w", err)
+	}
+	defer rows.Close()
+
+	var reviews []storage.Review
+	for rows.Next() {
+		r := storage.Review{UserName: userName}
+		var at int64
+		if err := rows.Scan(&r.Name, &r.Card, &r.Correct, &at); err != nil {
+			return nil, fmt.Errorf("can't scan review: %w", err)
+		}
+		r.At = time.Unix(at, 0)
+		reviews = append(reviews, r)
+	}
+	return reviews, nil
+}
+
+func (s *Storage) WrongCards(ctx context.Context, userName, name string) ([]string, error) {
+	// the latest review of every card decides whether it was wrong last time
+	q := `SELECT card FROM review_log r
+        WHERE user_name = ? AND name = ? AND correct = 0
+        AND id = (SELECT MAX(id) FROM review_log
+            WHERE user_name = r.user_name AND name = r.name AND card = r.card)`
+	rows, err := s.db.QueryContext(ctx, q, userName, name)
+	if err != nil {
+		return nil, fmt.Errorf("can't list wrong cards: %w", err)
+	}
+	defer rows.Close()
+
+	var cards []string
+	for rows.Next() {
+		var card string
+		if err := rows.Scan(&card); err != nil {
+			return nil, fmt.Errorf("can't scan card: %w", err)
+		}
+		cards = append(cards, card)
+	}
+	return cards, nil
+}
+
 func (s *Storage) List(ctx context.Context, userName string) ([]string, error) {
 	q := `SELECT name FROM items WHERE user_name = ?`
 	rows, err := s.db.QueryContext(ctx, q, userName)
@@ -98,3 +394,434 @@ func (s *Storage) List(ctx context.Context, userName string) ([]string, error) {
 	}
 	return names, nil
 }
+
+func (s *Storage) CreateShare(ctx context.Context, sh *storage.Share) error {
+	q := `INSERT INTO shares (code, owner, name, author) VALUES (?, ?, ?, ?)`
+	if _, err := s.db.ExecContext(ctx, q, sh.Code, sh.Owner, sh.Name, sh.Author); err != nil {
+		return fmt.Errorf("can't create share: %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) GetShare(ctx context.Context, code string) (*storage.Share, error) {
+	// shares made before authors were kept show the owner, as they used to
+	q := `SELECT owner, name, COALESCE(NULLIF(author, ''), owner) FROM shares WHERE code = ?`
+	sh := storage.Share{Code: code}
+	err := s.db.QueryRowContext(ctx, q, code).Scan(&sh.Owner, &sh.Name, &sh.Author)
+	if err == sql.ErrNoRows {
+		return nil, storage.ErrNoShare
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't get share: %w", err)
+	}
+	return &sh, nil
+}
+
+func (s *Storage) ShareOf(ctx context.Context, owner, name string) (*storage.Share, error) {
+	q := `SELECT code, author FROM shares WHERE owner = ? AND name = ?`
+	sh := storage.Share{Owner: owner, Name: name}
+	err := s.db.QueryRowContext(ctx, q, owner, name).Scan(&sh.Code, &sh.Author)
+	if err == sql.ErrNoRows {
+		return nil, storage.ErrNoShare
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't get share: %w", err)
+	}
+	return &sh, nil
+}
+
+func (s *Storage) Subscribe(ctx context.Context, sub *storage.Subscription) error {
+	q := `INSERT INTO subscriptions (user_name, chat_id, name, owner, deck) VALUES (?, ?, ?, ?, ?)`
+	if _, err := s.db.ExecContext(ctx, q, sub.UserName, sub.ChatID, sub.Name, sub.Owner, sub.Deck); err != nil {
+		return fmt.Errorf("can't subscribe: %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) GetSubscription(ctx context.Context, userName, name string) (*storage.Subscription, error) {
+	q := `SELECT chat_id, owner, deck FROM subscriptions WHERE user_name = ? AND name = ?`
+	sub := storage.Subscription{UserName: userName, Name: name}
+	err := s.db.QueryRowContext(ctx, q, userName, name).Scan(&sub.ChatID, &sub.Owner, &sub.Deck)
+	if err == sql.ErrNoRows {
+		return nil, storage.ErrNoSubscription
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't get subscription: %w", err)
+	}
+	return &sub, nil
+}
+
+func (s *Storage) Subscriptions(ctx context.Context, userName string) ([]storage.Subscription, error) {
+	q := `SELECT chat_id, name, owner, deck FROM subscriptions WHERE user_name = ?`
+	rows, err := s.db.QueryContext(ctx, q, userName)
+	if err != nil {
+		return nil, fmt.Errorf("can't list subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	var subs []storage.Subscription
+	for rows.Next() {
+		sub := storage.Subscription{UserName: userName}
+		if err := rows.Scan(&sub.ChatID, &sub.Name, &sub.Owner, &sub.Deck); err != nil {
+			return nil, fmt.Errorf("can't scan subscription: %w", err)
+		}
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
+
+func (s *Storage) Unsubscribe(ctx context.Context, userName, name string) error {
+	q := `DELETE FROM subscriptions WHERE user_name = ? AND name = ?`
+	if _, err := s.db.ExecContext(ctx, q, userName, name); err != nil {
+		return fmt.Errorf("can't unsubscribe: %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) Subscribers(ctx context.Context, owner, name string) ([]storage.Subscription, error) {
+	q := `SELECT user_name, chat_id, name FROM subscriptions WHERE owner = ? AND deck = ?`
+	rows, err := s.db.QueryContext(ctx, q, owner, name)
+	if err != nil {
+		return nil, fmt.Errorf("can't list subscribers: %w", err)
+	}
+	defer rows.Close()
+
+	var subs []storage.Subscription
+	for rows.Next() {
+		sub := storage.Subscription{Owner: owner, Deck: name}
+		if err := rows.Scan(&sub.UserName, &sub.ChatID, &sub.Name); err != nil {
+			return nil, fmt.Errorf("can't scan subscription: %w", err)
+		}
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
+
+// AddPoint gives a user a point, taking over the migrated score earned
+// under the same name before scores were kept per user
+func (s *Storage) AddPoint(ctx context.Context, chatID, userID int, userName string) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("can't add point: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var old int
+	q := `SELECT COALESCE(SUM(points), 0) FROM player_scores WHERE chat_id = ? AND user_id < 0 AND user_name = ?`
+	if err := tx.QueryRowContext(ctx, q, chatID, userName).Scan(&old); err != nil {
+		return fmt.Errorf("can't add point: %w", err)
+	}
+	q = `DELETE FROM player_scores WHERE chat_id = ? AND user_id < 0 AND user_name = ?`
+	if _, err := tx.ExecContext(ctx, q, chatID, userName); err != nil {
+		return fmt.Errorf("can't add point: %w", err)
+	}
+
+	q = `INSERT INTO player_scores (chat_id, user_id, user_name, points) VALUES (?, ?, ?, ?)
+        ON CONFLICT (chat_id, user_id) DO UPDATE SET
+            user_name = excluded.user_name, points = points + excluded.points`
+	if _, err := tx.ExecContext(ctx, q, chatID, userID, userName, old+1); err != nil {
+		return fmt.Errorf("can't add point: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("can't add point: %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) Leaderboard(ctx context.Context, chatID, limit int) ([]storage.Score, error) {
+	q := `SELECT user_id, user_name, points FROM player_scores WHERE chat_id = ?
+        ORDER BY points DESC, user_name LIMIT ?`
+	rows, err := s.db.QueryContext(ctx, q, chatID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("can't get leaderboard: %w", err)
+	}
+	defer rows.Close()
+
+	var scores []storage.Score
+	for rows.Next() {
+		var sc storage.Score
+		if err := rows.Scan(&sc.UserID, &sc.UserName, &sc.Points); err != nil {
+			return nil, fmt.Errorf("can't scan score: %w", err)
+		}
+		scores = append(scores, sc)
+	}
+	return scores, nil
+}
+
+func (s *Storage) SetLanguage(ctx context.Context, userID int, lang string) error {
+	q := `INSERT INTO languages (user_id, language) VALUES (?, ?)
+        ON CONFLICT (user_id) DO UPDATE SET language = excluded.language`
+	if _, err := s.db.ExecContext(ctx, q, userID, lang); err != nil {
+		return fmt.Errorf("can't set language: %w", err)
+	}
+	return nil
+}
+
+// Language returns the language the user picked, or "" if they didn't
+func (s *Storage) Language(ctx context.Context, userID int) (string, error) {
+	q := `SELECT language FROM languages WHERE user_id = ?`
+	var lang string
+	err := s.db.QueryRowContext(ctx, q, userID).Scan(&lang)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("can't get language: %w", err)
+	}
+	return lang, nil
+}
+
+func (s *Storage) RemoveLanguage(ctx context.Context, userID int) error {
+	q := `DELETE FROM languages WHERE user_id = ?`
+	if _, err := s.db.ExecContext(ctx, q, userID); err != nil {
+		return fmt.Errorf("can't remove language: %w", err)
+	}
+	return nil
+}
+
+// handledUpdatesKept is how many of the latest update ids are remembered.
+// Telegram only redelivers the updates after the offset it was last sent,
+// so older ids can't come back.
+const handledUpdatesKept = 1000
+
+func (s *Storage) MarkUpdateHandled(ctx context.Context, updateID int) error {
+	q := `INSERT OR IGNORE INTO handled_updates (update_id, handled_at) VALUES (?, ?)`
+	if _, err := s.db.ExecContext(ctx, q, updateID, time.Now().Unix()); err != nil {
+		return fmt.Errorf("can't mark update: %w", err)
+	}
+
+	q = `DELETE FROM handled_updates WHERE update_id <= ?`
+	if _, err := s.db.ExecContext(ctx, q, updateID-handledUpdatesKept); err != nil {
+		return fmt.Errorf("can't forget old updates: %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) IsUpdateHandled(ctx context.Context, updateID int) (bool, error) {
+	q := `SELECT COUNT(*) FROM handled_updates WHERE update_id = ?`
+	var count int
+	if err := s.db.QueryRowContext(ctx, q, updateID).Scan(&count); err != nil {
+		return false, fmt.Errorf("can't check update: %w", err)
+	}
+	return count > 0, nil
+}
+
+// LastUpdate returns the id of the latest handled update and when it was
+// handled, or 0 if none was
+func (s *Storage) LastUpdate(ctx context.Context) (int, time.Time, error) {
+	q := `SELECT update_id, handled_at FROM handled_updates ORDER BY update_id DESC LIMIT 1`
+	var id, at int64
+	err := s.db.QueryRowContext(ctx, q).Scan(&id, &at)
+	if err == sql.ErrNoRows {
+		return 0, time.Time{}, nil
+	}
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("can't get last update: %w", err)
+	}
+	return int(id), time.Unix(at, 0), nil
+}
+
+// AddDeadLetter stores a failed update, replacing an earlier failure of
+// the same update, e.g. when a replay failed again
+func (s *Storage) AddDeadLetter(ctx context.Context, dl *storage.DeadLetter) error {
+	q := `INSERT OR REPLACE INTO dead_letters (update_id, raw, reason, attempts, failed_at)
+        VALUES (?, ?, ?, ?, ?)`
+	if _, err := s.db.ExecContext(ctx, q, dl.UpdateID, dl.Raw, dl.Reason, dl.Attempts, dl.FailedAt.Unix()); err != nil {
+		return fmt.Errorf("can't add dead letter: %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) DeadLetter(ctx context.Context, updateID int) (*storage.DeadLetter, error) {
+	q := `SELECT raw, reason, attempts, failed_at FROM dead_letters WHERE update_id = ?`
+	dl := storage.DeadLetter{UpdateID: updateID}
+	var failedAt int64
+	err := s.db.QueryRowContext(ctx, q, updateID).Scan(&dl.Raw, &dl.Reason, &dl.Attempts, &failedAt)
+	if err == sql.ErrNoRows {
+		return nil, storage.ErrNoDeadLetter
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't get dead letter: %w", err)
+	}
+	dl.FailedAt = time.Unix(failedAt, 0)
+	return &dl, nil
+}
+
+// DeadLetters returns all dead letters, oldest update first
+func (s *Storage) DeadLetters(ctx context.Context) ([]storage.DeadLetter, error) {
+	q := `SELECT update_id, raw, reason, attempts, failed_at FROM dead_letters ORDER BY update_id`
+	rows, err := s.db.QueryContext(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("can't list dead letters: %w", err)
+	}
+	defer rows.Close()
+
+	var letters []storage.DeadLetter
+	for rows.Next() {
+		var (
+			dl       storage.DeadLetter
+			failedAt int64
+		)
+		if err := rows.Scan(&dl.UpdateID, &dl.Raw, &dl.Reason, &dl.Attempts, &failedAt); err != nil {
+			return nil, fmt.Errorf("can't scan dead letter: %w", err)
+		}
+		dl.FailedAt = time.Unix(failedAt, 0)
+		letters = append(letters, dl)
+	}
+	return letters, nil
+}
+
+func (s *Storage) RemoveDeadLetter(ctx context.Context, updateID int) error {
+	q := `DELETE FROM dead_letters WHERE update_id = ?`
+	if _, err := s.db.ExecContext(ctx, q, updateID); err != nil {
+		return fmt.Errorf("can't remove dead letter: %w", err)
+	}
+	return nil
+}
+
+func direction(it *storage.Item) storage.Direction {
+	if it.Direction == "" {
+		return storage.DirectionForward
+	}
+	return it.Direction
+}
+
+func (s *Storage) SetReminder(ctx context.Context, r *storage.Reminder) error {
+	// keep last_sent so changing the time doesn't repeat today's reminder
+	q := `INSERT INTO reminders (user_name, chat_id, minute, time_zone) VALUES (?, ?, ?, ?)
+        ON CONFLICT (user_name) DO UPDATE SET
+            chat_id = excluded.chat_id, minute = excluded.minute, time_zone = excluded.time_zone`
+	if _, err := s.db.ExecContext(ctx, q, r.UserName, r.ChatID, r.Minute, r.TimeZone); err != nil {
+		return fmt.Errorf("can't set reminder: %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) GetReminder(ctx context.Context, userName string) (*storage.Reminder, error) {
+	q := `SELECT chat_id, minute, time_zone, last_sent FROM reminders WHERE user_name = ?`
+	r := storage.Reminder{UserName: userName}
+	err := s.db.QueryRowContext(ctx, q, userName).Scan(&r.ChatID, &r.Minute, &r.TimeZone, &r.LastSent)
+	if err == sql.ErrNoRows {
+		return nil, storage.ErrNoReminder
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't get reminder: %w", err)
+	}
+	return &r, nil
+}
+
+func (s *Storage) RemoveReminder(ctx context.Context, userName string) error {
+	q := `DELETE FROM reminders WHERE user_name = ?`
+	if _, err := s.db.ExecContext(ctx, q, userName); err != nil {
+		return fmt.Errorf("can't remove reminder: %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) Reminders(ctx context.Context) ([]storage.Reminder, error) {
+	q := `SELECT user_name, chat_id, minute, time_zone, last_sent FROM reminders`
+	rows, err := s.db.QueryContext(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("can't list reminders: %w", err)
+	}
+	defer rows.Close()
+
+	var reminders []storage.Reminder
+	for rows.Next() {
+		var r storage.Reminder
+		if err := rows.Scan(&r.UserName, &r.ChatID, &r.Minute, &r.TimeZone, &r.LastSent); err != nil {
+			return nil, fmt.Errorf("can't scan reminder: %w", err)
+		}
+		reminders = append(reminders, r)
+	}
+	return reminders, nil
+}
+
+func (s *Storage) MarkReminded(ctx context.Context, userName, day string) error {
+	q := `UPDATE reminders SET last_sent = ? WHERE user_name = ?`
+	if _, err := s.db.ExecContext(ctx, q, day, userName); err != nil {
+		return fmt.Errorf("can't mark reminder as sent: %w", err)
+	}
+	return nil
+}
+
+// ClaimOwner moves what older versions kept under a Telegram username,
+// decks, reviews, the reminder, shares and subscriptions, to owner.
+// Rows owner already has one of by the same key stay where they are.
+func (s *Storage) ClaimOwner(ctx context.Context, userName, owner string) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("can't claim owner: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	names, err := itemNames(ctx, tx, userName)
+	if err != nil {
+		return err
+	}
+	// the hash is derived from the owner, so it changes along
+	for _, name := range names {
+		h, err := storage.Item{UserName: owner, Name: name}.Hash()
+		if err != nil {
+			return err
+		}
+		q := `UPDATE OR IGNORE items SET hash = ?, user_name = ? WHERE user_name = ? AND name = ?`
+		if _, err := tx.ExecContext(ctx, q, h, owner, userName, name); err != nil {
+			return fmt.Errorf("can't claim items: %w", err)
+		}
+	}
+
+	for _, q := range []string{
+		`UPDATE review_log SET user_name = ? WHERE user_name = ?`,
+		`UPDATE OR IGNORE reminders SET user_name = ? WHERE user_name = ?`,
+		`UPDATE OR IGNORE subscriptions SET user_name = ? WHERE user_name = ?`,
+		`UPDATE subscriptions SET owner = ? WHERE owner = ?`,
+		`UPDATE OR IGNORE shares SET owner = ? WHERE owner = ?`,
+	} {
+		if _, err := tx.ExecContext(ctx, q, owner, userName); err != nil {
+			return fmt.Errorf("can't claim owner: %w", err)
+		}
+	}
+	q := `UPDATE shares SET author = ? WHERE owner = ? AND author = ''`
+	if _, err := tx.ExecContext(ctx, q, "@"+userName, owner); err != nil {
+		return fmt.Errorf("can't claim shares: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("can't claim owner: %w", err)
+	}
+	return nil
+}
+
+func itemNames(ctx context.Context, tx *sql.Tx, userName string) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT name FROM items WHERE user_name = ?`, userName)
+	if err != nil {
+		return nil, fmt.Errorf("can't list items: %w", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("can't scan name: %w", err)
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+func visibility(it *storage.Item) storage.Visibility {
+	if it.Visibility == "" {
+		return storage.VisibilityPrivate
+	}
+	return it.Visibility
+}
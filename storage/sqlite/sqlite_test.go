@@ -0,0 +1,119 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"flashcard/storage"
+)
+
+func newTestStorage(t *testing.T, setup ...string) *Storage {
+	t.Helper()
+
+	s, err := New(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.db.Close() })
+
+	for _, q := range setup {
+		if _, err := s.db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestScoresByUser(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t,
+		`CREATE TABLE scores (chat_id INTEGER, user_name TEXT, points INTEGER, PRIMARY KEY (chat_id, user_name))`,
+		`INSERT INTO scores VALUES (1, '@alice', 3), (1, 'Bob', 2)`,
+	)
+
+	// two users called Bob score apart, the first one takes the old points
+	for _, p := range []struct {
+		user int
+		name string
+	}{{10, "Bob"}, {11, "Bob"}, {12, "@alice"}} {
+		if err := s.AddPoint(ctx, 1, p.user, p.name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := s.Leaderboard(ctx, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []storage.Score{
+		{UserID: 12, UserName: "@alice", Points: 4},
+		{UserID: 10, UserName: "Bob", Points: 3},
+		{UserID: 11, UserName: "Bob", Points: 1},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("score %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	// the old table is gone, so opening again doesn't bring the points back
+	if err := s.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := s.Leaderboard(ctx, 1, 10); len(again) != len(want) {
+		t.Errorf("after another Init got %+v", again)
+	}
+}
+
+func TestClaimOwner(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+
+	deck := &storage.Item{UserName: "alice", Name: "spanish", Content: "q: hola\na: hello"}
+	if err := s.Save(ctx, deck); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateShare(ctx, &storage.Share{Code: "abc", Owner: "alice", Name: "spanish"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Subscribe(ctx, &storage.Subscription{UserName: "bob", Name: "es", Owner: "alice", Deck: "spanish"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.ClaimOwner(ctx, "alice", "user:7"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Get(ctx, "user:7", "spanish"); err != nil {
+		t.Errorf("claimed deck: %v", err)
+	}
+	if _, err := s.Get(ctx, "alice", "spanish"); !errors.Is(err, storage.ErrNoSavedItems) {
+		t.Errorf("deck still under the username: %v", err)
+	}
+	sh, err := s.GetShare(ctx, "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sh.Owner != "user:7" || sh.Author != "@alice" {
+		t.Errorf("share is %+v", sh)
+	}
+	sub, err := s.GetSubscription(ctx, "bob", "es")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.Owner != "user:7" {
+		t.Errorf("subscription points at %q", sub.Owner)
+	}
+
+	// whoever takes the username next starts afresh
+	if err := s.Save(ctx, &storage.Item{UserName: "alice", Name: "spanish", Content: "q: si\na: yes"}); err != nil {
+		t.Errorf("saving under the freed username: %v", err)
+	}
+}
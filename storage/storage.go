@@ -6,6 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"strings"
+	"time"
 
 	"flashcard/lib/e"
 )
@@ -20,13 +22,142 @@ type Storage interface {
 	Remove(ctx context.Context, it *Item) error
 	IsExists(ctx context.Context, it *Item) (bool, error)
 	List(ctx context.Context, user string) ([]string, error)
+	Update(ctx context.Context, it *Item) error
+	AddReview(ctx context.Context, r *Review) error
+	Reviews(ctx context.Context, user string, since time.Time) ([]Review, error)
+	WrongCards(ctx context.Context, user, name string) ([]string, error)
+	RemoveReviews(ctx context.Context, user, name string) error
+	SetReminder(ctx context.Context, r *Reminder) error
+	GetReminder(ctx context.Context, user string) (*Reminder, error)
+	RemoveReminder(ctx context.Context, user string) error
+	Reminders(ctx context.Context) ([]Reminder, error)
+	MarkReminded(ctx context.Context, user, day string) error
+	CreateShare(ctx context.Context, sh *Share) error
+	GetShare(ctx context.Context, code string) (*Share, error)
+	ShareOf(ctx context.Context, owner, name string) (*Share, error)
+	Subscribe(ctx context.Context, sub *Subscription) error
+	GetSubscription(ctx context.Context, user, name string) (*Subscription, error)
+	Subscriptions(ctx context.Context, user string) ([]Subscription, error)
+	Unsubscribe(ctx context.Context, user, name string) error
+	Subscribers(ctx context.Context, owner, name string) ([]Subscription, error)
+	AddPoint(ctx context.Context, chatID, userID int, userName string) error
+	Leaderboard(ctx context.Context, chatID, limit int) ([]Score, error)
+	SetLanguage(ctx context.Context, userID int, lang string) error
+	Language(ctx context.Context, userID int) (string, error)
+	RemoveLanguage(ctx context.Context, userID int) error
+	MarkUpdateHandled(ctx context.Context, updateID int) error
+	IsUpdateHandled(ctx context.Context, updateID int) (bool, error)
+	LastUpdate(ctx context.Context) (int, time.Time, error)
+	AddDeadLetter(ctx context.Context, dl *DeadLetter) error
+	DeadLetter(ctx context.Context, updateID int) (*DeadLetter, error)
+	DeadLetters(ctx context.Context) ([]DeadLetter, error)
+	RemoveDeadLetter(ctx context.Context, updateID int) error
+	ClaimOwner(ctx context.Context, userName, owner string) error
 }
 
+// ErrNoDeadLetter indicates an unknown dead letter
+var ErrNoDeadLetter = errors.New("no dead letter")
+
+// DeadLetter is an update that could not be processed, kept to be replayed
+type DeadLetter struct {
+	UpdateID int
+	Raw      []byte // the update as Telegram sent it
+	Reason   string // the last error
+	Attempts int
+	FailedAt time.Time
+}
+
+// Score is a user's points in a group quiz
+type Score struct {
+	UserID   int
+	UserName string // how the user was called when they last scored
+	Points   int
+}
+
+// ErrNoShare indicates an unknown share code or an unshared deck
+var ErrNoShare = errors.New("no share")
+
+// ErrNoSubscription indicates the user isn't subscribed to a deck by that name
+var ErrNoSubscription = errors.New("no subscription")
+
+// Share is a code that gives others access to a deck
+type Share struct {
+	Code   string
+	Owner  string // owner of the deck
+	Name   string // deck name
+	Author string // how whoever shared it is shown
+}
+
+// Subscription links a deck of another owner into a user's decks
+type Subscription struct {
+	UserName string
+	ChatID   int    // where to tell the subscriber about new cards
+	Name     string // the name the subscriber sees
+	Owner    string
+	Deck     string // the name of the deck at its owner
+}
+
+// ErrNoReminder indicates the user has no daily reminder
+var ErrNoReminder = errors.New("no reminder")
+
+// DayLayout is how the local date of the last reminder is stored
+const DayLayout = "2006-01-02"
+
+// Reminder is a user's daily review reminder
+type Reminder struct {
+	UserName string
+	ChatID   int
+	Minute   int    // minutes after local midnight
+	TimeZone string // IANA name, e.g. "Europe/Berlin"
+	LastSent string // local date (YYYY-MM-DD) of the last reminder, if any
+}
+
+// Review is a single graded answer to a card during a quiz
+type Review struct {
+	UserName string
+	Name     string // deck name
+	Card     string // the question as it was asked
+	Correct  bool
+	At       time.Time
+}
+
+// Direction controls which side of a card is shown as the question
+type Direction string
+
+const (
+	DirectionForward Direction = "forward"
+	DirectionReverse Direction = "reverse"
+	DirectionBoth    Direction = "both"
+)
+
+// ErrUnknownDirection is returned for an unsupported direction name
+var ErrUnknownDirection = errors.New("unknown direction")
+
+// ParseDirection converts user input into a Direction
+func ParseDirection(s string) (Direction, error) {
+	switch d := Direction(strings.ToLower(strings.TrimSpace(s))); d {
+	case DirectionForward, DirectionReverse, DirectionBoth:
+		return d, nil
+	default:
+		return "", ErrUnknownDirection
+	}
+}
+
+// Visibility controls who can see a deck besides its owner
+type Visibility string
+
+const (
+	VisibilityPrivate Visibility = "private"
+	VisibilityShared  Visibility = "shared" // anyone with the share code
+)
+
 // Item represents a named text entry by a user
 type Item struct {
-	Name     string
-	Content  string
-	UserName string
+	Name       string
+	Content    string
+	UserName   string // the owner of the deck
+	Direction  Direction
+	Visibility Visibility
 }
 
 func (i Item) Hash() (string, error) {